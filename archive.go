@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grishinsana/goftx"
+)
+
+// archiveDir is the directory below the output directory that keeps every
+// API response, one folder per account.
+const archiveDir = "raw"
+
+// archiveEntry is one line of an archive file.
+type archiveEntry struct {
+	Endpoint   string            `json:"endpoint"`
+	Params     map[string]string `json:"params,omitempty"`
+	Subaccount string            `json:"subaccount,omitempty"`
+	FetchedAt  time.Time         `json:"fetchedAt"`
+	Status     int               `json:"status"`
+	Response   json.RawMessage   `json:"response"`
+}
+
+// archiveFileName returns the file the responses of an endpoint are kept in.
+// Endpoints with an ID in the path share one file, the responses of
+// "/conditional_orders/123/triggers" are kept in
+// "conditional_orders_id_triggers.ndjson.gz".
+func archiveFileName(endpoint string) string {
+	parts := strings.Split(strings.Trim(endpoint, "/"), "/")
+
+	for i, part := range parts {
+		if _, err := strconv.ParseInt(part, 10, 64); err == nil {
+			parts[i] = "id"
+		}
+	}
+
+	return strings.Join(parts, "_") + ".ndjson.gz"
+}
+
+// archiveTransport saves the response of every API request of one account
+// before it is handed to the goftx client. Every entry is written as its own
+// gzip member, so the files stay readable when a run is interrupted and later
+// runs simply append to them.
+type archiveTransport struct {
+	dir        string
+	subAccount string
+	base       http.RoundTripper
+	mu         sync.Mutex
+}
+
+func newArchiveTransport(outDir, account, subAccount string) *archiveTransport {
+	return &archiveTransport{
+		dir:        filepath.Join(outDir, archiveDir, account),
+		subAccount: subAccount,
+		base:       http.DefaultTransport,
+	}
+}
+
+func (t *archiveTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+
+	if err != nil {
+		return resp, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	// Error pages of proxies are no API responses.
+	if !json.Valid(body) {
+		return resp, nil
+	}
+
+	params := map[string]string{}
+
+	for k, v := range req.URL.Query() {
+		params[k] = strings.Join(v, ",")
+	}
+
+	entry := &archiveEntry{
+		Endpoint:   strings.TrimPrefix(req.URL.Path, "/api"),
+		Params:     params,
+		Subaccount: t.subAccount,
+		FetchedAt:  time.Now().UTC(),
+		Status:     resp.StatusCode,
+		Response:   body,
+	}
+
+	if err := t.write(entry); err != nil {
+		return nil, fmt.Errorf("archiving %s: %w", req.URL.Path, err)
+	}
+
+	return resp, nil
+}
+
+func (t *archiveTransport) write(entry *archiveEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := os.MkdirAll(t.dir, 0777); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(filepath.Join(t.dir, archiveFileName(entry.Endpoint)), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	zw := gzip.NewWriter(file)
+
+	if _, err := zw.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+// archive reads the responses saved by archiveTransport.
+type archive struct {
+	dir string
+}
+
+func openArchive(outDir string) (*archive, error) {
+	dir := filepath.Join(outDir, archiveDir)
+
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+
+	return &archive{dir: dir}, nil
+}
+
+// accounts returns the labels of the archived accounts, the main account
+// first.
+func (a *archive) accounts() ([]string, error) {
+	entries, err := os.ReadDir(a.dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var labels []string
+
+	for _, e := range entries {
+		if e.IsDir() {
+			labels = append(labels, e.Name())
+		}
+	}
+
+	sort.SliceStable(labels, func(i, j int) bool {
+		return labels[i] == "Main" && labels[j] != "Main"
+	})
+
+	return labels, nil
+}
+
+// entries returns the archived responses of an endpoint in the order they
+// were fetched.
+func (a *archive) entries(account, endpoint string) ([]*archiveEntry, error) {
+	file, err := os.Open(filepath.Join(a.dir, account, archiveFileName(endpoint)))
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	zr, err := gzip.NewReader(bufio.NewReader(file))
+
+	if err == io.EOF {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer zr.Close()
+
+	var entries []*archiveEntry
+	dec := json.NewDecoder(zr)
+
+	for {
+		entry := &archiveEntry{}
+		err := dec.Decode(entry)
+
+		if err == io.EOF {
+			return entries, nil
+		}
+
+		// The last member is cut off when a run was killed while writing it.
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return entries, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+}
+
+// pages returns the results of the successful responses of an endpoint.
+func (a *archive) pages(account, endpoint string) ([]json.RawMessage, error) {
+	entries, err := a.entries(account, endpoint)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var pages []json.RawMessage
+
+	for _, entry := range entries {
+		var resp goftx.Response
+
+		if err := json.Unmarshal(entry.Response, &resp); err != nil {
+			return nil, err
+		}
+
+		if resp.Success {
+			pages = append(pages, resp.Result)
+		}
+	}
+
+	return pages, nil
+}
+
+// pagesByEndpoint returns the newest successful response of every endpoint
+// that shares the archive file of endpoint, keyed by the endpoint.
+func (a *archive) pagesByEndpoint(account, endpoint string) (map[string]json.RawMessage, error) {
+	entries, err := a.entries(account, endpoint)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pages := map[string]json.RawMessage{}
+
+	for _, entry := range entries {
+		var resp goftx.Response
+
+		if err := json.Unmarshal(entry.Response, &resp); err != nil {
+			return nil, err
+		}
+
+		if resp.Success {
+			pages[entry.Endpoint] = resp.Result
+		}
+	}
+
+	return pages, nil
+}
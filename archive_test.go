@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/grishinsana/goftx"
+)
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// fillsServer answers the fills endpoint with the fills between start_time
+// and end_time, newest first.
+func fillsServer(fills []map[string]interface{}) roundTripFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		start, _ := strconv.ParseInt(req.URL.Query().Get("start_time"), 10, 64)
+		end, _ := strconv.ParseInt(req.URL.Query().Get("end_time"), 10, 64)
+		page := []map[string]interface{}{}
+
+		for _, f := range fills {
+			if sec := f["_sec"].(int); int64(sec) >= start && int64(sec) <= end {
+				page = append(page, f)
+			}
+		}
+
+		body, err := json.Marshal(map[string]interface{}{"success": true, "result": page})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(bytes.NewReader(body)), Request: req}, nil
+	}
+}
+
+// TestArchiveRender exports fills through the archive and checks that render
+// rebuilds the same file from it.
+func TestArchiveRender(t *testing.T) {
+	var fills []map[string]interface{}
+
+	for i, market := range []string{"BTC/USD", "BTC-PERP", "ETH/BTC", "BTC/USD"} {
+		tm := at(60 - 10*i)
+		fill := map[string]interface{}{
+			"id": 100 + i, "market": market, "side": "buy", "price": "0.0700000001", "size": "1.5", "fee": "0.00012345678901234",
+			"feeCurrency": "USD", "feeRate": "0.0007", "liquidity": "taker", "orderId": 5000 + i, "tradeId": 9000 + i, "type": "order",
+			"time": tm.Add(123456789).Format("2006-01-02T15:04:05.999999999Z07:00"), "_sec": int(tm.Unix()),
+		}
+
+		if market == "BTC-PERP" {
+			fill["future"] = market
+		} else {
+			fill["baseCurrency"], fill["quoteCurrency"] = market[:3], market[4:]
+		}
+
+		fills = append(fills, fill)
+	}
+
+	liveDir, renderDir := t.TempDir(), t.TempDir()
+	transport := newArchiveTransport(liveDir, "Main", "")
+	transport.base = fillsServer(fills)
+	client := goftx.New(goftx.WithAuth("key", "secret"), goftx.WithHTTPClient(&http.Client{Transport: transport}))
+	f := fetcherOf("transaction_history")
+	state, err := loadState(filepath.Join(liveDir, stateFile))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	live := &exportJob{fetcher: f, ctx: context.Background(), client: client, state: state, account: "Main", outFile: exportPath(liveDir, "Main", f)}
+
+	if n, err := f.ds.export(live); err != nil || n != int64(len(fills)) {
+		t.Fatalf("export = %d, %v, want %d records", n, err, len(fills))
+	}
+
+	// Every response is a gzip member with one NDJSON line.
+	file, err := os.Open(filepath.Join(liveDir, archiveDir, "Main", archiveFileName("/fills")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	zr, err := gzip.NewReader(file)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := bufio.NewScanner(zr)
+	entries := 0
+
+	for lines.Scan() {
+		var entry archiveEntry
+
+		if err := json.Unmarshal(lines.Bytes(), &entry); err != nil || entry.Endpoint != "/fills" {
+			t.Fatalf("archive line %q: %v", lines.Text(), err)
+		}
+
+		entries++
+	}
+
+	if err := lines.Err(); err != nil || entries == 0 {
+		t.Fatalf("read %d archive entries: %v", entries, err)
+	}
+
+	raw, err := openArchive(liveDir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rendered := &exportJob{fetcher: f, account: "Main", outFile: exportPath(renderDir, "Main", f)}
+
+	if _, err := f.ds.render(rendered, raw); err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := os.ReadFile(live.outFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(rendered.outFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("rendered file differs from the export:\n%s\nwant:\n%s", got, want)
+	}
+}
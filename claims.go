@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kataras/golog"
+	"github.com/shopspring/decimal"
+)
+
+// loadClaimSchedule reads the scheduled quantity of every coin from a CSV
+// file or XLSX workbook with a coin and a quantity column. Coins listed more
+// than once are added up.
+func loadClaimSchedule(path string) (map[string]decimal.Decimal, error) {
+	rows, err := readSheet(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	h, cols, ok := findHeader(rows, isCoinColumn, func(name string) bool {
+		return strings.Contains(name, "quantity") || name == "qty"
+	})
+
+	if !ok {
+		h, cols, ok = findHeader(rows, isCoinColumn, func(name string) bool {
+			return strings.Contains(name, "amount") || strings.Contains(name, "balance")
+		})
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("%s: claim schedule needs a coin and a quantity column", path)
+	}
+
+	scheduled := map[string]decimal.Decimal{}
+
+	for i, row := range rows[h+1:] {
+		coin, raw := strings.ToUpper(cell(row, cols[0])), cell(row, cols[1])
+
+		if coin == "" || raw == "" {
+			continue
+		}
+
+		qty, err := parseAmount(raw)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: row %d: invalid quantity %q of %s", path, h+i+2, raw, coin)
+		}
+
+		scheduled[coin] = scheduled[coin].Add(qty)
+	}
+
+	return scheduled, nil
+}
+
+// claimLine compares the scheduled quantity of a coin with the holdings
+// rebuilt from the history.
+type claimLine struct {
+	coin      string
+	scheduled decimal.Decimal
+	listed    bool
+	rebuilt   decimal.Decimal
+	// Holdings of the coin by account.
+	holdings []*holding
+}
+
+func (l *claimLine) difference() decimal.Decimal {
+	return l.scheduled.Sub(l.rebuilt)
+}
+
+func (l *claimLine) status(tolerance decimal.Decimal) string {
+	switch {
+	case !l.listed:
+		return "missing from schedule"
+	case len(l.holdings) == 0:
+		return "not in history"
+	case l.difference().Abs().GreaterThan(tolerance):
+		return "differs"
+	}
+
+	return "match"
+}
+
+// attribution lists the accounts holding the coin, "Main: 1.5; Sub1: 0.2".
+func (l *claimLine) attribution() string {
+	parts := make([]string, 0, len(l.holdings))
+
+	for _, h := range l.holdings {
+		parts = append(parts, fmt.Sprintf("%s: %s", h.account, outFormat.decimal(h.balance)))
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+// compareClaims matches the schedule with the holdings of all accounts, the
+// schedule lists the claim of the customer and not of single subaccounts.
+func compareClaims(scheduled map[string]decimal.Decimal, holdings []*holding) []*claimLine {
+	lines := map[string]*claimLine{}
+
+	line := func(coin string) *claimLine {
+		if lines[coin] == nil {
+			lines[coin] = &claimLine{coin: coin}
+		}
+
+		return lines[coin]
+	}
+
+	for coin, qty := range scheduled {
+		l := line(coin)
+		l.scheduled, l.listed = qty, true
+	}
+
+	for _, h := range holdings {
+		l := line(h.coin)
+		l.rebuilt = l.rebuilt.Add(h.balance)
+		l.holdings = append(l.holdings, h)
+	}
+
+	result := make([]*claimLine, 0, len(lines))
+
+	for _, l := range lines {
+		result = append(result, l)
+	}
+
+	sort.Slice(result, func(a, b int) bool {
+		return result[a].coin < result[b].coin
+	})
+
+	return result
+}
+
+// writeClaimComparison writes one row per coin, logs every coin that does not
+// match and returns their number.
+func writeClaimComparison(path string, at time.Time, lines []*claimLine, tolerance decimal.Decimal) (int, error) {
+	file, err := os.Create(path)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer file.Close()
+
+	csvWriter := outFormat.csvWriter(file)
+	csvWriter.Write([]string{"Coin", "Scheduled", "Rebuilt", "Difference", "Status", "AsOf", "Subaccounts"})
+	problems := 0
+
+	for _, l := range lines {
+		status := l.status(tolerance)
+
+		if status != "match" {
+			problems++
+			golog.Warnf("%s %s: scheduled %s, history gives %s %s", l.coin, status, l.scheduled, l.rebuilt, l.attribution())
+		}
+
+		csvWriter.Write([]string{l.coin, outFormat.decimal(l.scheduled), outFormat.decimal(l.rebuilt), outFormat.decimal(l.difference()), status, outFormat.time(at), l.attribution()})
+	}
+
+	csvWriter.Flush()
+
+	if err := csvWriter.Error(); err != nil {
+		return problems, err
+	}
+
+	return problems, file.Close()
+}
+
+// claimsReport compares the claim schedule with the holdings of all accounts
+// exported to dir at the time at and returns the number of coins that do not
+// match.
+func claimsReport(dir, schedulePath, out string, at time.Time, tolerance decimal.Decimal) (int, error) {
+	accounts, err := exportedAccounts(dir)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if len(accounts) == 0 {
+		return 0, fmt.Errorf("no exported accounts found in %s", dir)
+	}
+
+	scheduled, err := loadClaimSchedule(schedulePath)
+
+	if err != nil {
+		return 0, err
+	}
+
+	holdings, err := holdingsAt(dir, accounts, at)
+
+	if err != nil {
+		return 0, err
+	}
+
+	lines := compareClaims(scheduled, holdings)
+	problems, err := writeClaimComparison(out, at, lines, tolerance)
+
+	if err != nil {
+		return problems, err
+	}
+
+	golog.Infof("Compared %d coins of the claim schedule with the history as of %s", len(lines), at)
+	return problems, addReportToManifest(dir, out, "claim_comparison")
+}
@@ -0,0 +1,700 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/kataras/golog"
+	"github.com/ncruces/zenity"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+const usage = `Usage: ftx-export [command] [flags]
+
+Commands:
+  export   Download the account history of the main account and all subaccounts
+  gui      Ask for the API credentials with dialogs and run an export
+  verify   Check an output directory against its manifest.json
+  render   Rebuild all export files from the raw archive without network access
+  gains    Match disposals with tax lots and write a realized-gains report
+  value    Write a copy of every dataset with the USD value of each row
+  snapshot Write the balance of every coin and account at a point in time
+  claims   Compare the claim schedule with the holdings at the petition date
+  reconcile
+           Replay the history into balances and compare them with the wallets
+  help     Show this help
+
+Running ftx-export without a command starts the gui when a display is
+available and prints this help otherwise.
+
+Credentials are taken from the -key/-secret flags, the FTX_API_KEY and
+FTX_API_SECRET environment variables or, with -credentials-stdin, from the
+first two lines of stdin (key first, secret second).
+
+Main export flags:
+  -out DIR         directory the export files are written to
+  -full            download the complete history again
+  -sqlite FILE     also write all datasets to a SQLite database
+  -parquet, -xlsx  also write Parquet datasets or an Excel workbook
+  -profiles LIST   also write tax tool import files
+  -ledger, -journals LIST
+                   also write a normalized ledger or accounting journals
+  -from, -to, -subaccounts, -coins, -markets
+                   limit the export
+  -time-format, -timezone, -decimal-separator, -delimiter
+                   format of the CSV files
+
+Exports are incremental, later runs only append new records. README.md
+describes the files of every dataset and output.
+
+Run "ftx-export <command> -h" to list the flags of a command.
+`
+
+type exportOptions struct {
+	key    string
+	secret string
+	outDir string
+	full   bool
+	// Number of datasets downloaded at the same time.
+	concurrency int
+	noArchive   bool
+	// SQLite database that receives all datasets, none when empty.
+	sqlite  string
+	parquet bool
+	xlsx    bool
+	// Text format of the CSV files, nil keeps the format of outDir.
+	format *textFormat
+	filter *exportFilter
+	// Tax tools an import file is written for.
+	profiles []*taxProfile
+	// Write a ledger per account and one of all accounts.
+	ledger    bool
+	ledgerAll bool
+	// Plain text accounting journals of all accounts.
+	journals []*journalFormat
+	journal  journalAccounts
+}
+
+func runCLI(args []string) int {
+	if len(args) == 0 {
+		if hasDisplay() {
+			return runGUI(nil)
+		}
+
+		fmt.Fprint(os.Stderr, usage)
+		return exitUsage
+	}
+
+	switch cmd := args[0]; cmd {
+	case "export":
+		return runExport(args[1:])
+	case "gui":
+		return runGUI(args[1:])
+	case "verify":
+		return runVerify(args[1:])
+	case "render":
+		return runRender(args[1:])
+	case "gains":
+		return runGains(args[1:])
+	case "value":
+		return runValue(args[1:])
+	case "snapshot":
+		return runSnapshot(args[1:])
+	case "claims":
+		return runClaims(args[1:])
+	case "reconcile":
+		return runReconcile(args[1:])
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+		return exitOK
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", cmd, usage)
+		return exitUsage
+	}
+}
+
+func runExport(args []string) int {
+	opts := &exportOptions{}
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.StringVar(&opts.key, "key", "", "FTX API key (default $FTX_API_KEY)")
+	fs.StringVar(&opts.secret, "secret", "", "FTX API secret (default $FTX_API_SECRET)")
+	fs.StringVar(&opts.outDir, "out", ".", "directory the export files are written to")
+	fs.BoolVar(&opts.full, "full", false, "ignore the checkpoints of earlier runs and download the complete history again")
+	fs.IntVar(&opts.concurrency, "concurrency", 4, "number of datasets downloaded at the same time")
+	fs.IntVar(&maxRetries, "retries", maxRetries, "number of retries of rate limited or failed requests")
+	fs.BoolVar(&opts.noArchive, "no-archive", false, "do not save the raw API responses")
+	fs.StringVar(&opts.sqlite, "sqlite", "", "also write all datasets to this SQLite database, updating it on every run")
+	fs.BoolVar(&opts.parquet, "parquet", false, "also write every dataset as Parquet")
+	fs.BoolVar(&opts.xlsx, "xlsx", false, "also write an Excel workbook of all accounts")
+	format := formatFlags(fs)
+	filter := filterFlags(fs)
+	profiles := fs.String("profiles", "", "comma separated tax tools to write import files for: "+strings.Join(profileNames(), ", "))
+	fs.BoolVar(&opts.ledger, "ledger", false, "also write a chronological ledger of every account")
+	fs.BoolVar(&opts.ledgerAll, "ledger-all", false, "also write one chronological ledger of all accounts")
+	journals := fs.String("journals", "", "comma separated plain text accounting journals to write: beancount, ledger")
+	fs.StringVar(&opts.journal.deposits, "deposit-account", "Assets:External", "journal account deposits come from")
+	fs.StringVar(&opts.journal.withdrawals, "withdrawal-account", "Assets:External", "journal account withdrawals go to")
+	fromStdin := fs.Bool("credentials-stdin", false, "read the API key and secret from the first two lines of stdin")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	var err error
+
+	if opts.profiles, err = parseProfiles(*profiles); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	if opts.journals, err = parseJournalFormats(*journals); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	if opts.format, err = format(opts.outDir); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	if opts.filter, err = filter(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	if err := loadCredentials(opts, *fromStdin, os.Stdin); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	if err := export(opts); err != nil {
+		golog.Error(err)
+		return exitFailure
+	}
+
+	return exitOK
+}
+
+func runGUI(args []string) int {
+	opts := &exportOptions{}
+	fs := flag.NewFlagSet("gui", flag.ContinueOnError)
+	fs.StringVar(&opts.outDir, "out", ".", "directory the export files are written to")
+	fs.IntVar(&opts.concurrency, "concurrency", 4, "number of datasets downloaded at the same time")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	var err error
+
+	opts.key, err = zenity.Entry("API Key", zenity.Title("Paste your API key"))
+	if err != nil {
+		return exitFailure
+	}
+
+	opts.secret, err = zenity.Entry("API Secret", zenity.Title("Paste your API secret"))
+	if err != nil {
+		return exitFailure
+	}
+
+	err = export(opts)
+	if err != nil {
+		golog.Error(err)
+	}
+
+	// Keep the console window open so the log can be read.
+	done := make(chan struct{})
+	fmt.Println("FINISHED!")
+	fmt.Println("Press CTRL+C to close this window")
+	<-done
+	return exitOK
+}
+
+func runVerify(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	dir := fs.String("dir", ".", "output directory of the export")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	if err := useTextFormat(*dir); err != nil {
+		golog.Error(err)
+		return exitFailure
+	}
+
+	problems, err := verifyDir(*dir, os.Stdout)
+
+	if err != nil {
+		golog.Error(err)
+		return exitFailure
+	}
+
+	if problems > 0 {
+		golog.Errorf("%d problems found", problems)
+		return exitFailure
+	}
+
+	golog.Info("All files match the manifest")
+	return exitOK
+}
+
+func runRender(args []string) int {
+	opts := &exportOptions{}
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+	dir := fs.String("dir", ".", "output directory of the export that holds the raw archive")
+	fs.StringVar(&opts.outDir, "out", "", "directory the rebuilt files are written to (default -dir)")
+	fs.StringVar(&opts.sqlite, "sqlite", "", "also write all datasets to this SQLite database")
+	fs.BoolVar(&opts.parquet, "parquet", false, "also write every dataset as Parquet")
+	fs.BoolVar(&opts.xlsx, "xlsx", false, "also write an Excel workbook of all accounts")
+	format := formatFlags(fs)
+	filter := filterFlags(fs)
+	profiles := fs.String("profiles", "", "comma separated tax tools to write import files for: "+strings.Join(profileNames(), ", "))
+	fs.BoolVar(&opts.ledger, "ledger", false, "also write a chronological ledger of every account")
+	fs.BoolVar(&opts.ledgerAll, "ledger-all", false, "also write one chronological ledger of all accounts")
+	journals := fs.String("journals", "", "comma separated plain text accounting journals to write: beancount, ledger")
+	fs.StringVar(&opts.journal.deposits, "deposit-account", "Assets:External", "journal account deposits come from")
+	fs.StringVar(&opts.journal.withdrawals, "withdrawal-account", "Assets:External", "journal account withdrawals go to")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	var err error
+
+	if opts.profiles, err = parseProfiles(*profiles); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	if opts.journals, err = parseJournalFormats(*journals); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	if opts.outDir == "" {
+		opts.outDir = *dir
+	}
+
+	if opts.format, err = format(opts.outDir); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	if opts.filter, err = filter(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	if err := render(*dir, opts); err != nil {
+		golog.Error(err)
+		return exitFailure
+	}
+
+	return exitOK
+}
+
+func runGains(args []string) int {
+	fs := flag.NewFlagSet("gains", flag.ContinueOnError)
+	dir := fs.String("dir", ".", "output directory of the export")
+	methodName := fs.String("method", "fifo", "cost basis method: fifo, lifo, hifo or average")
+	out := fs.String("out", "", "report file (default realized_gains_<method>.csv in -dir)")
+	cacheDir := fs.String("prices", "", "price cache directory (default prices/ in -dir)")
+	offline := fs.Bool("offline", false, "only use cached prices")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	if err := useTextFormat(*dir); err != nil {
+		golog.Error(err)
+		return exitFailure
+	}
+
+	method, err := parseCostMethod(*methodName)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	if *out == "" {
+		*out = filepath.Join(*dir, fmt.Sprintf("realized_gains_%s.csv", method))
+	}
+
+	if err := gainsReport(*dir, *out, method, openPriceCache(*dir, *cacheDir, *offline)); err != nil {
+		golog.Error(err)
+		return exitFailure
+	}
+
+	return exitOK
+}
+
+func runValue(args []string) int {
+	fs := flag.NewFlagSet("value", flag.ContinueOnError)
+	dir := fs.String("dir", ".", "output directory of the export")
+	cacheDir := fs.String("prices", "", "price cache directory (default prices/ in -dir)")
+	offline := fs.Bool("offline", false, "only use cached prices")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	if err := useTextFormat(*dir); err != nil {
+		golog.Error(err)
+		return exitFailure
+	}
+
+	accounts, err := exportedAccounts(*dir)
+
+	if err == nil && len(accounts) == 0 {
+		err = fmt.Errorf("no exported accounts found in %s", *dir)
+	}
+
+	if err != nil {
+		golog.Error(err)
+		return exitFailure
+	}
+
+	items, err := valueDir(*dir, accounts, openPriceCache(*dir, *cacheDir, *offline))
+
+	if manifestErr := addToManifest(*dir, items...); err == nil {
+		err = manifestErr
+	}
+
+	if err != nil {
+		golog.Error(err)
+		return exitFailure
+	}
+
+	return exitOK
+}
+
+func runSnapshot(args []string) int {
+	fs := flag.NewFlagSet("snapshot", flag.ContinueOnError)
+	dir := fs.String("dir", ".", "output directory of the export")
+	atStr := fs.String("at", petitionDate.Format("2006-01-02"), "date or RFC 3339 time of the snapshot, records from then on are left out")
+	priceTable := fs.String("price-table", "", "CSV file with the USD price of every coin")
+	out := fs.String("out", "", "schedule file (default balance_snapshot_<date>.csv in -dir)")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	if err := useTextFormat(*dir); err != nil {
+		golog.Error(err)
+		return exitFailure
+	}
+
+	at, err := parseSnapshotTime(*atStr)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	if *out == "" {
+		*out = filepath.Join(*dir, snapshotFile(at))
+	}
+
+	if err := snapshotReport(*dir, *out, at, *priceTable); err != nil {
+		golog.Error(err)
+		return exitFailure
+	}
+
+	return exitOK
+}
+
+func runClaims(args []string) int {
+	fs := flag.NewFlagSet("claims", flag.ContinueOnError)
+	dir := fs.String("dir", ".", "output directory of the export")
+	schedule := fs.String("schedule", "", "claim schedule, a CSV or XLSX file with a coin and a quantity column")
+	atStr := fs.String("at", petitionDate.Format("2006-01-02"), "date or RFC 3339 time the schedule is valid at")
+	out := fs.String("out", "", "comparison file (default claim_comparison.csv in -dir)")
+	tolerance := fs.String("tolerance", "0.00000001", "largest difference that still counts as a match")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	if err := useTextFormat(*dir); err != nil {
+		golog.Error(err)
+		return exitFailure
+	}
+
+	if *schedule == "" {
+		fmt.Fprintln(os.Stderr, "missing -schedule")
+		return exitUsage
+	}
+
+	at, err := parseSnapshotTime(*atStr)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	maxDiff, err := decimal.NewFromString(*tolerance)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid tolerance %q\n", *tolerance)
+		return exitUsage
+	}
+
+	if *out == "" {
+		*out = filepath.Join(*dir, "claim_comparison.csv")
+	}
+
+	problems, err := claimsReport(*dir, *schedule, *out, at, maxDiff)
+
+	if err != nil {
+		golog.Error(err)
+		return exitFailure
+	}
+
+	if problems > 0 {
+		golog.Errorf("%d coins differ from the claim schedule", problems)
+		return exitFailure
+	}
+
+	golog.Info("The claim schedule matches the history")
+	return exitOK
+}
+
+func runReconcile(args []string) int {
+	opts := &exportOptions{}
+	fs := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	fs.StringVar(&opts.key, "key", "", "FTX API key (default $FTX_API_KEY)")
+	fs.StringVar(&opts.secret, "secret", "", "FTX API secret (default $FTX_API_SECRET)")
+	fs.StringVar(&opts.outDir, "dir", ".", "output directory of the export")
+	fs.BoolVar(&opts.noArchive, "no-archive", false, "do not save the raw API responses")
+	tolerance := fs.String("tolerance", "0.00000001", "largest gap that still counts as a match")
+	fromStdin := fs.Bool("credentials-stdin", false, "read the API key and secret from the first two lines of stdin")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	if err := useTextFormat(opts.outDir); err != nil {
+		golog.Error(err)
+		return exitFailure
+	}
+
+	maxGap, err := decimal.NewFromString(*tolerance)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid tolerance %q\n", *tolerance)
+		return exitUsage
+	}
+
+	if err := loadCredentials(opts, *fromStdin, os.Stdin); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	mismatches, items, err := reconcileDir(context.Background(), opts.outDir, newClient(opts, ""), maxGap)
+
+	if manifestErr := addToManifest(opts.outDir, items...); err == nil {
+		err = manifestErr
+	}
+
+	if err != nil {
+		golog.Error(err)
+		return exitFailure
+	}
+
+	if mismatches > 0 {
+		golog.Errorf("%d balances do not match the history", mismatches)
+		return exitFailure
+	}
+
+	golog.Info("All balances match the history")
+	return exitOK
+}
+
+// formatFlags adds the flags of the text format to fs. The returned function
+// applies the given flags to the format of the files in dir, it returns nil
+// when none was given.
+func formatFlags(fs *flag.FlagSet) func(dir string) (*textFormat, error) {
+	timeFormat := fs.String("time-format", "", "timestamps as go, rfc3339, unix or unixms (default go)")
+	timezone := fs.String("timezone", "", "IANA timezone timestamps are converted to, for example Europe/Berlin (default UTC)")
+	decimalSeparator := fs.String("decimal-separator", "", "decimal separator of numbers, . or , (default .)")
+	delimiter := fs.String("delimiter", "", "CSV delimiter, a character or tab (default , or ; with a decimal comma)")
+
+	return func(dir string) (*textFormat, error) {
+		given := map[string]bool{}
+
+		fs.Visit(func(f *flag.Flag) {
+			given[f.Name] = true
+		})
+
+		if !given["time-format"] && !given["timezone"] && !given["decimal-separator"] && !given["delimiter"] {
+			return nil, nil
+		}
+
+		current, err := loadTextFormat(dir)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !given["time-format"] {
+			*timeFormat = current.Time
+		}
+
+		if !given["timezone"] {
+			*timezone = current.Timezone
+		}
+
+		if !given["decimal-separator"] {
+			*decimalSeparator = current.DecimalSeparator
+		}
+
+		// The delimiter follows a changed decimal separator.
+		if !given["delimiter"] && !given["decimal-separator"] {
+			*delimiter = current.Delimiter
+		}
+
+		return newTextFormat(*timeFormat, *timezone, *decimalSeparator, *delimiter)
+	}
+}
+
+// filterFlags adds the flags of the export filter to fs. The returned
+// function builds the filter, nil when no flag was given.
+func filterFlags(fs *flag.FlagSet) func() (*exportFilter, error) {
+	from := fs.String("from", "", "only records from this date or RFC 3339 time on")
+	to := fs.String("to", "", "only records before this date or RFC 3339 time")
+	subaccounts := fs.String("subaccounts", "", "comma separated subaccounts to export, glob patterns, Main is the main account")
+	excludeSubaccounts := fs.String("exclude-subaccounts", "", "comma separated subaccounts not to export, glob patterns")
+	coins := fs.String("coins", "", "comma separated coins, only records of these coins are written")
+	excludeCoins := fs.String("exclude-coins", "", "comma separated coins, records of these coins are left out")
+	markets := fs.String("markets", "", "comma separated markets, only fills, funding and orders of these markets are written")
+	excludeMarkets := fs.String("exclude-markets", "", "comma separated markets, fills, funding and orders of these markets are left out")
+
+	return func() (*exportFilter, error) {
+		f := &exportFilter{
+			Subaccounts:        splitList(*subaccounts, false),
+			ExcludeSubaccounts: splitList(*excludeSubaccounts, false),
+			Coins:              splitList(*coins, true),
+			ExcludeCoins:       splitList(*excludeCoins, true),
+			Markets:            splitList(*markets, true),
+			ExcludeMarkets:     splitList(*excludeMarkets, true),
+		}
+
+		if *from != "" {
+			t, err := parseSnapshotTime(*from)
+
+			if err != nil {
+				return nil, err
+			}
+
+			f.From = &t
+		}
+
+		if *to != "" {
+			t, err := parseSnapshotTime(*to)
+
+			if err != nil {
+				return nil, err
+			}
+
+			f.To = &t
+		}
+
+		return newExportFilter(f)
+	}
+}
+
+// loadCredentials fills in missing credentials, preferring flags over the
+// environment over stdin.
+func loadCredentials(opts *exportOptions, fromStdin bool, stdin io.Reader) error {
+	if opts.key == "" {
+		opts.key = os.Getenv("FTX_API_KEY")
+	}
+
+	if opts.secret == "" {
+		opts.secret = os.Getenv("FTX_API_SECRET")
+	}
+
+	if fromStdin && (opts.key == "" || opts.secret == "") {
+		scanner := bufio.NewScanner(stdin)
+		lines := make([]string, 0, 2)
+
+		for len(lines) < 2 && scanner.Scan() {
+			lines = append(lines, strings.TrimSpace(scanner.Text()))
+		}
+
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("reading credentials from stdin: %w", err)
+		}
+
+		if len(lines) < 2 {
+			return errors.New("expected the API key and secret on the first two lines of stdin")
+		}
+
+		if opts.key == "" {
+			opts.key = lines[0]
+		}
+
+		if opts.secret == "" {
+			opts.secret = lines[1]
+		}
+	}
+
+	if opts.key == "" || opts.secret == "" {
+		return errors.New("missing API credentials, use -key/-secret, FTX_API_KEY/FTX_API_SECRET or -credentials-stdin")
+	}
+
+	return nil
+}
+
+// hasDisplay reports whether the zenity dialogs can be shown.
+func hasDisplay() bool {
+	switch runtime.GOOS {
+	case "windows", "darwin":
+		return true
+	}
+
+	return os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != ""
+}
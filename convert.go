@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/grishinsana/goftx"
+	"github.com/grishinsana/goftx/models"
+)
+
+// Conversions are the quotes of the Convert feature. Only filled quotes moved
+// coins, Cost of FromCoin was exchanged for Proceeds of ToCoin.
+var conversionsDataset = &csvDataset[*models.Quote]{
+	endpoints: []string{"/otc/quotes/history"},
+	columns: &table{
+		name: "conversions",
+		columns: []column{
+			{name: "ID", kind: kindInt},
+			{name: "BaseCoin", kind: kindString},
+			{name: "QuoteCoin", kind: kindString},
+			{name: "FromCoin", kind: kindString},
+			{name: "ToCoin", kind: kindString},
+			{name: "Side", kind: kindString},
+			{name: "Price", kind: kindDecimal},
+			{name: "Cost", kind: kindDecimal},
+			{name: "Proceeds", kind: kindDecimal},
+			{name: "Filled", kind: kindBool},
+			{name: "Expired", kind: kindBool},
+			{name: "Expiry", kind: kindTime},
+			{name: "Time", kind: kindTime},
+		},
+		primaryKey: []string{"id"},
+		indexes:    []string{"time", "from_coin", "to_coin"},
+	},
+	fetch: func(client *goftx.Client, _ *exportFilter) pageFunc[*models.Quote] {
+		return client.Convert.GetQuoteHistory
+	},
+	pageSize: ftxPageSize,
+	key: func(q *models.Quote) (time.Time, string) {
+		return q.Time, strconv.FormatInt(q.ID, 10)
+	},
+	subject: func(q *models.Quote) ([]string, string) {
+		return []string{q.FromCoin, q.ToCoin}, ""
+	},
+	values: func(q *models.Quote) []interface{} {
+		return []interface{}{
+			q.ID,
+			q.BaseCoin,
+			q.QuoteCoin,
+			q.FromCoin,
+			q.ToCoin,
+			string(q.Side),
+			q.Price,
+			q.Cost,
+			q.Proceeds,
+			q.Filled,
+			q.Expired,
+			q.Expiry,
+			q.Time,
+		}
+	},
+}
@@ -0,0 +1,634 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kataras/golog"
+	"github.com/shopspring/decimal"
+)
+
+// costMethod decides which lots a disposal is matched with.
+type costMethod string
+
+const (
+	methodFIFO    costMethod = "fifo"
+	methodLIFO    costMethod = "lifo"
+	methodHIFO    costMethod = "hifo"
+	methodAverage costMethod = "average"
+)
+
+var costMethods = []costMethod{methodFIFO, methodLIFO, methodHIFO, methodAverage}
+
+func parseCostMethod(name string) (costMethod, error) {
+	for _, m := range costMethods {
+		if string(m) == strings.ToLower(name) {
+			return m, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown cost basis method %q, available: fifo, lifo, hifo, average", name)
+}
+
+// priceFunc returns the USD value of one unit of a coin at a time.
+type priceFunc func(coin string, t time.Time) (decimal.Decimal, bool)
+
+// lot is a quantity of a coin acquired at once. cost is the USD cost of the
+// remaining quantity including the fees of the acquisition.
+type lot struct {
+	acquired time.Time
+	qty      decimal.Decimal
+	cost     decimal.Decimal
+	// False when the acquisition had no USD value.
+	known bool
+}
+
+func (l *lot) unitCost() decimal.Decimal {
+	if l.qty.IsZero() {
+		return decimal.Zero
+	}
+
+	return l.cost.Div(l.qty)
+}
+
+// realizedGain is the part of a disposal that was matched with one lot.
+type realizedGain struct {
+	account  string
+	coin     string
+	qty      decimal.Decimal
+	acquired time.Time
+	disposed time.Time
+	proceeds decimal.Decimal
+	fees     decimal.Decimal
+	cost     decimal.Decimal
+	note     string
+}
+
+func (g *realizedGain) gain() decimal.Decimal {
+	return g.proceeds.Sub(g.fees).Sub(g.cost)
+}
+
+// book keeps the open lots of every coin. USD is the currency gains are
+// measured in and has no lots.
+type book struct {
+	method costMethod
+	price  priceFunc
+	lots   map[string][]*lot
+	gains  []*realizedGain
+}
+
+func newBook(method costMethod, price priceFunc) *book {
+	return &book{method: method, price: price, lots: map[string][]*lot{}}
+}
+
+// value returns the USD value of an amount of a coin.
+func (b *book) value(coin string, amount decimal.Decimal, t time.Time) (decimal.Decimal, bool) {
+	p, ok := b.price(coin, t)
+	return amount.Mul(p), ok
+}
+
+func (b *book) acquire(coin string, t time.Time, qty, cost decimal.Decimal, known bool) {
+	if coin == "USD" || !qty.IsPositive() {
+		return
+	}
+
+	lots := b.lots[coin]
+
+	// The average method keeps a single pool per coin, dated by its oldest
+	// acquisition.
+	if b.method == methodAverage && len(lots) > 0 {
+		pool := lots[0]
+		pool.qty = pool.qty.Add(qty)
+		pool.cost = pool.cost.Add(cost)
+		pool.known = pool.known && known
+		return
+	}
+
+	b.lots[coin] = append(lots, &lot{acquired: t, qty: qty, cost: cost, known: known})
+}
+
+// dispose removes a quantity from the lots of a coin. Taxable disposals are
+// reported with their share of the proceeds and fees, transfers out of the
+// exchange only reduce the lots.
+func (b *book) dispose(account, coin string, t time.Time, qty, proceeds, fees decimal.Decimal, taxable bool, note string) {
+	if coin == "USD" || !qty.IsPositive() {
+		return
+	}
+
+	remaining := qty
+
+	for remaining.IsPositive() {
+		l := b.nextLot(coin)
+
+		if l == nil {
+			break
+		}
+
+		take := decimal.Min(remaining, l.qty)
+		cost := l.cost
+
+		if take.LessThan(l.qty) {
+			cost = l.unitCost().Mul(take)
+		}
+
+		l.qty = l.qty.Sub(take)
+		l.cost = l.cost.Sub(cost)
+		remaining = remaining.Sub(take)
+
+		if l.qty.IsZero() {
+			b.removeLot(coin, l)
+		}
+
+		if taxable {
+			g := b.gain(account, coin, take, qty, t, proceeds, fees, note)
+			g.acquired = l.acquired
+			g.cost = cost
+
+			if b.method == methodAverage {
+				g.acquired = time.Time{}
+			}
+
+			if !l.known {
+				g.note = joinNotes(g.note, "unknown cost basis")
+			}
+		}
+	}
+
+	if remaining.IsPositive() && taxable {
+		b.gain(account, coin, remaining, qty, t, proceeds, fees, joinNotes(note, "no acquisition found"))
+	}
+}
+
+// gain adds the report row of the part take of a disposal of qty.
+func (b *book) gain(account, coin string, take, qty decimal.Decimal, t time.Time, proceeds, fees decimal.Decimal, note string) *realizedGain {
+	// Multiplying first keeps shares like a third exact.
+	g := &realizedGain{
+		account:  account,
+		coin:     coin,
+		qty:      take,
+		disposed: t,
+		proceeds: proceeds.Mul(take).Div(qty),
+		fees:     fees.Mul(take).Div(qty),
+		note:     note,
+	}
+
+	b.gains = append(b.gains, g)
+	return g
+}
+
+// nextLot returns the lot the method disposes of first.
+func (b *book) nextLot(coin string) *lot {
+	lots := b.lots[coin]
+
+	if len(lots) == 0 {
+		return nil
+	}
+
+	switch b.method {
+	case methodLIFO:
+		return lots[len(lots)-1]
+	case methodHIFO:
+		highest := lots[0]
+
+		for _, l := range lots[1:] {
+			if l.unitCost().GreaterThan(highest.unitCost()) {
+				highest = l
+			}
+		}
+
+		return highest
+	}
+
+	return lots[0]
+}
+
+func (b *book) removeLot(coin string, l *lot) {
+	lots := b.lots[coin]
+
+	for i := range lots {
+		if lots[i] == l {
+			b.lots[coin] = append(lots[:i], lots[i+1:]...)
+			return
+		}
+	}
+}
+
+func joinNotes(a, b string) string {
+	if a == "" {
+		return b
+	}
+
+	return a + "; " + b
+}
+
+// lotEvent is a record that changes the lots, applied in time order.
+type lotEvent struct {
+	time time.Time
+	// Deposits go first and withdrawals last within the same second.
+	rank  int
+	apply func(b *book)
+}
+
+// loadLotEvents reads the spot fills, deposits and withdrawals of the
+// accounts. The accounts share one set of lots, transfers between
+// subaccounts are not part of the history.
+func loadLotEvents(dir string, accounts []string) ([]*lotEvent, error) {
+	var events []*lotEvent
+
+	for _, account := range accounts {
+		account := account
+
+		fills, err := loadRecords(dir, account, "transaction_history")
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range fills {
+			if f.str("future") != "" {
+				continue
+			}
+
+			f := f
+			events = append(events, &lotEvent{time: f.time("time"), rank: 1, apply: func(b *book) {
+				b.applyFill(account, f)
+			}})
+		}
+
+		deposits, err := loadRecords(dir, account, "deposit_history")
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, d := range deposits {
+			if !transferDone(d.str("status")) {
+				continue
+			}
+
+			d := d
+			events = append(events, &lotEvent{time: d.time("time"), rank: 0, apply: func(b *book) {
+				t := d.time("time")
+				qty := d.dec("size").Sub(d.dec("fee"))
+				cost, known := b.value(d.str("coin"), qty, t)
+				b.acquire(d.str("coin"), t, qty, cost, known)
+			}})
+		}
+
+		withdrawals, err := loadRecords(dir, account, "withdrawal_history")
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, w := range withdrawals {
+			if !transferDone(w.str("status")) {
+				continue
+			}
+
+			w := w
+			events = append(events, &lotEvent{time: w.time("time"), rank: 2, apply: func(b *book) {
+				qty := w.dec("size").Add(w.dec("fee"))
+				b.dispose(account, w.str("coin"), w.time("time"), qty, decimal.Zero, decimal.Zero, false, "")
+			}})
+		}
+
+		// Staking rewards and airdrops are income, acquired at their value.
+		for _, dataset := range []string{"staking_rewards", "airdrops"} {
+			income, err := loadRecords(dir, account, dataset)
+
+			if err != nil {
+				return nil, err
+			}
+
+			for _, r := range income {
+				if !transferDone(r.str("status")) {
+					continue
+				}
+
+				r := r
+				events = append(events, &lotEvent{time: r.time("time"), rank: 0, apply: func(b *book) {
+					t := r.time("time")
+					cost, known := b.value(r.str("coin"), r.dec("size"), t)
+					b.acquire(r.str("coin"), t, r.dec("size"), cost, known)
+				}})
+			}
+		}
+
+		conversions, err := loadRecords(dir, account, "conversions")
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range conversions {
+			if !c.bool("filled") {
+				continue
+			}
+
+			c := c
+			events = append(events, &lotEvent{time: c.time("time"), rank: 1, apply: func(b *book) {
+				b.applyConversion(account, c)
+			}})
+		}
+
+		// Leveraged tokens are created and redeemed for USD, the fee is
+		// part of the cost of a creation and the fees of a redemption.
+		creations, err := loadRecords(dir, account, "lt_creations")
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range creations {
+			if c.bool("pending") {
+				continue
+			}
+
+			c := c
+			events = append(events, &lotEvent{time: c.time("fulfilled_at"), rank: 1, apply: func(b *book) {
+				b.acquire(c.str("token"), c.time("fulfilled_at"), c.dec("created_size"), c.dec("cost").Add(c.dec("fee")), true)
+			}})
+		}
+
+		redemptions, err := loadRecords(dir, account, "lt_redemptions")
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range redemptions {
+			if r.bool("pending") {
+				continue
+			}
+
+			r := r
+			events = append(events, &lotEvent{time: r.time("fulfilled_at"), rank: 1, apply: func(b *book) {
+				b.dispose(account, r.str("token"), r.time("fulfilled_at"), r.dec("size"), r.dec("proceeds").Add(r.dec("fee")), r.dec("fee"), true, "")
+			}})
+		}
+	}
+
+	sort.SliceStable(events, func(a, b int) bool {
+		if !events[a].time.Equal(events[b].time) {
+			return events[a].time.Before(events[b].time)
+		}
+
+		return events[a].rank < events[b].rank
+	})
+
+	return events, nil
+}
+
+// applyFill turns a spot fill into disposals and acquisitions. The value of a
+// fill is the USD value of its quote amount. Fees paid in the coin that is
+// received reduce the quantity, fees in any other coin are a disposal of
+// that coin and part of the cost of a buy or the fees of a sale.
+func (b *book) applyFill(account string, f record) {
+	t := f.time("time")
+	base, quote := f.str("base_currency"), f.str("quote_currency")
+	size := f.dec("size")
+	quoteQty := size.Mul(f.dec("price"))
+	fee, feeCoin := f.dec("fee"), f.str("fee_currency")
+
+	v, known := b.value(quote, quoteQty, t)
+	note := ""
+
+	if !known {
+		note = "no USD price for " + quote
+	}
+
+	feeV := decimal.Zero
+
+	if fee.IsPositive() {
+		var feeKnown bool
+		feeV, feeKnown = b.value(feeCoin, fee, t)
+
+		if !feeKnown {
+			note = joinNotes(note, "no USD price for fee in "+feeCoin)
+		}
+	} else if fee.IsNegative() {
+		// Maker rebates are acquired at their value.
+		rebateV, rebateKnown := b.value(feeCoin, fee.Neg(), t)
+		b.acquire(feeCoin, t, fee.Neg(), rebateV, rebateKnown)
+		fee = decimal.Zero
+	}
+
+	feeIn := func(coin string) decimal.Decimal {
+		if feeCoin == coin {
+			return fee
+		}
+
+		return decimal.Zero
+	}
+
+	otherFee := fee.IsPositive() && feeCoin != base && feeCoin != quote
+
+	if f.str("side") == "buy" {
+		cost := v
+
+		if feeCoin != base {
+			cost = cost.Add(feeV)
+		}
+
+		b.dispose(account, quote, t, quoteQty.Add(feeIn(quote)), v.Add(feeValueIn(feeCoin, quote, feeV)), decimal.Zero, true, note)
+		b.acquire(base, t, size.Sub(feeIn(base)), cost, known)
+	} else {
+		b.dispose(account, base, t, size.Add(feeIn(base)), v.Add(feeValueIn(feeCoin, base, feeV)), feeV, true, note)
+		b.acquire(quote, t, quoteQty.Sub(feeIn(quote)), v.Sub(feeValueIn(feeCoin, quote, feeV)), known)
+	}
+
+	if otherFee {
+		b.dispose(account, feeCoin, t, fee, feeV, decimal.Zero, true, joinNotes(note, "trading fee"))
+	}
+}
+
+// applyConversion disposes of the converted coin and acquires the received
+// coin, both at the USD value of the converted amount.
+func (b *book) applyConversion(account string, c record) {
+	t := c.time("time")
+	from, to := c.str("from_coin"), c.str("to_coin")
+	v, known := b.value(from, c.dec("cost"), t)
+	note := fmt.Sprintf("conversion %d", c.int("id"))
+
+	if !known {
+		note = joinNotes(note, "no USD price for "+from)
+	}
+
+	b.dispose(account, from, t, c.dec("cost"), v, decimal.Zero, true, note)
+	b.acquire(to, t, c.dec("proceeds"), v, known)
+}
+
+func feeValueIn(feeCoin, coin string, feeV decimal.Decimal) decimal.Decimal {
+	if feeCoin == coin {
+		return feeV
+	}
+
+	return decimal.Zero
+}
+
+// realizedGains matches the disposals of the accounts in dir with their lots.
+func realizedGains(dir string, accounts []string, method costMethod, price priceFunc) ([]*realizedGain, error) {
+	events, err := loadLotEvents(dir, accounts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	b := newBook(method, price)
+
+	for _, e := range events {
+		e.apply(b)
+	}
+
+	return b.gains, nil
+}
+
+var gainsHeader = []string{"Subaccount", "Coin", "Quantity", "Acquired", "Disposed", "Proceeds", "Fees", "Cost", "Gain", "Term", "Note"}
+
+// writeGains writes the realized-gains report. Gains of lots held for more
+// than a year are long term.
+func writeGains(path string, gains []*realizedGain) error {
+	file, err := os.Create(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	csvWriter := outFormat.csvWriter(file)
+	csvWriter.Write(gainsHeader)
+
+	for _, g := range gains {
+		acquired, term := "", ""
+
+		if !g.acquired.IsZero() {
+			acquired = outFormat.time(g.acquired)
+			term = "short"
+
+			if g.disposed.After(g.acquired.AddDate(1, 0, 0)) {
+				term = "long"
+			}
+		}
+
+		csvWriter.Write([]string{
+			subAccountOf(g.account),
+			g.coin,
+			outFormat.decimal(g.qty),
+			acquired,
+			outFormat.time(g.disposed),
+			outFormat.fixed(g.proceeds, 2),
+			outFormat.fixed(g.fees, 2),
+			outFormat.fixed(g.cost, 2),
+			outFormat.fixed(g.gain(), 2),
+			term,
+			g.note,
+		})
+	}
+
+	csvWriter.Flush()
+
+	if err := csvWriter.Error(); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+// gainsReport writes the realized gains of all accounts exported to dir to
+// out. A report inside dir is added to its manifest.
+func gainsReport(dir, out string, method costMethod, prices *priceCache) error {
+	accounts, err := exportedAccounts(dir)
+
+	if err != nil {
+		return err
+	}
+
+	if len(accounts) == 0 {
+		return fmt.Errorf("no exported accounts found in %s", dir)
+	}
+
+	gains, err := realizedGains(dir, accounts, method, prices.priceFunc())
+
+	if err != nil {
+		return err
+	}
+
+	if prices.err != nil {
+		return prices.err
+	}
+
+	if err := writeGains(out, gains); err != nil {
+		return err
+	}
+
+	total := decimal.Zero
+
+	for _, g := range gains {
+		total = total.Add(g.gain())
+	}
+
+	golog.Infof("Wrote %d disposals with a total gain of %s USD (%s) to %s", len(gains), total.StringFixed(2), method, out)
+
+	return addReportToManifest(dir, out, "realized_gains_"+string(method))
+}
+
+// datasetOf returns the account and the dataset of an exported CSV file, the
+// dataset with the longest matching name.
+func datasetOf(name string) (account, dataset string) {
+	for _, f := range fetchers {
+		suffix := "_" + f.dataset + f.ext
+
+		if strings.HasSuffix(name, suffix) && len(f.dataset) > len(dataset) {
+			account, dataset = strings.TrimSuffix(name, suffix), f.dataset
+		}
+	}
+
+	return account, dataset
+}
+
+// exportedAccounts returns the labels of the accounts with CSV files in dir,
+// the main account first.
+func exportedAccounts(dir string) ([]string, error) {
+	seen := map[string]bool{}
+	var labels []string
+
+	for _, f := range fetchers {
+		if f.ext != ".csv" {
+			continue
+		}
+
+		suffix := "_" + f.dataset + f.ext
+		matches, err := filepath.Glob(filepath.Join(dir, "*"+suffix))
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, m := range matches {
+			// Main_trigger_order_history.csv also ends in _order_history.csv.
+			label, dataset := datasetOf(filepath.Base(m))
+
+			if dataset != f.dataset {
+				continue
+			}
+
+			if !seen[label] {
+				seen[label] = true
+				labels = append(labels, label)
+			}
+		}
+	}
+
+	sort.Strings(labels)
+	sort.SliceStable(labels, func(i, j int) bool {
+		return labels[i] == "Main" && labels[j] != "Main"
+	})
+
+	return labels, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func dec(s string) decimal.Decimal {
+	return decimal.RequireFromString(s)
+}
+
+// testBook holds 1 BTC bought for 100, 1 for 300 and 1 for 200, in that
+// order.
+func testBook(method costMethod) *book {
+	b := newBook(method, func(string, time.Time) (decimal.Decimal, bool) {
+		return decimal.Zero, false
+	})
+
+	b.acquire("BTC", at(1), dec("1"), dec("100"), true)
+	b.acquire("BTC", at(2), dec("1"), dec("300"), true)
+	b.acquire("BTC", at(3), dec("1"), dec("200"), true)
+	return b
+}
+
+func TestDispose(t *testing.T) {
+	type gain struct {
+		qty, cost, proceeds string
+		acquired            time.Time
+	}
+
+	tests := []struct {
+		method costMethod
+		gains  []gain
+		// Quantity and cost left in the lots.
+		qty, cost string
+	}{
+		{methodFIFO, []gain{{"1", "100", "400", at(1)}, {"0.5", "150", "200", at(2)}}, "1.5", "350"},
+		{methodLIFO, []gain{{"1", "200", "400", at(3)}, {"0.5", "150", "200", at(2)}}, "1.5", "250"},
+		{methodHIFO, []gain{{"1", "300", "400", at(2)}, {"0.5", "100", "200", at(3)}}, "1.5", "200"},
+		{methodAverage, []gain{{"1.5", "300", "600", time.Time{}}}, "1.5", "300"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.method), func(t *testing.T) {
+			b := testBook(tt.method)
+			b.dispose("Main", "BTC", at(4), dec("1.5"), dec("600"), decimal.Zero, true, "")
+
+			if len(b.gains) != len(tt.gains) {
+				t.Fatalf("got %d gains, want %d", len(b.gains), len(tt.gains))
+			}
+
+			for i, want := range tt.gains {
+				g := b.gains[i]
+
+				if !g.qty.Equal(dec(want.qty)) || !g.cost.Equal(dec(want.cost)) || !g.proceeds.Equal(dec(want.proceeds)) || !g.acquired.Equal(want.acquired) {
+					t.Errorf("gain %d = %s BTC cost %s proceeds %s acquired %s, want %s BTC cost %s proceeds %s acquired %s",
+						i, g.qty, g.cost, g.proceeds, g.acquired, want.qty, want.cost, want.proceeds, want.acquired)
+				}
+			}
+
+			qty, cost := decimal.Zero, decimal.Zero
+
+			for _, l := range b.lots["BTC"] {
+				qty = qty.Add(l.qty)
+				cost = cost.Add(l.cost)
+			}
+
+			if !qty.Equal(dec(tt.qty)) || !cost.Equal(dec(tt.cost)) {
+				t.Errorf("lots hold %s BTC for %s, want %s for %s", qty, cost, tt.qty, tt.cost)
+			}
+		})
+	}
+}
+
+func TestDisposeWithoutLots(t *testing.T) {
+	for _, method := range costMethods {
+		t.Run(string(method), func(t *testing.T) {
+			b := testBook(method)
+			b.dispose("Main", "BTC", at(4), dec("4"), dec("800"), dec("8"), true, "")
+
+			if len(b.lots["BTC"]) != 0 {
+				t.Errorf("%d lots left, want none", len(b.lots["BTC"]))
+			}
+
+			last := b.gains[len(b.gains)-1]
+
+			if !last.qty.Equal(dec("1")) || !last.proceeds.Equal(dec("200")) || !last.fees.Equal(dec("2")) || last.note != "no acquisition found" {
+				t.Errorf("last gain = %s BTC proceeds %s fees %s %q, want the missing 1 BTC", last.qty, last.proceeds, last.fees, last.note)
+			}
+		})
+	}
+}
+
+func TestDisposeTransfer(t *testing.T) {
+	b := testBook(methodFIFO)
+	b.dispose("Main", "BTC", at(4), dec("1"), decimal.Zero, decimal.Zero, false, "")
+
+	if len(b.gains) != 0 {
+		t.Errorf("transfer realized %d gains", len(b.gains))
+	}
+
+	if l := b.lots["BTC"]; len(l) != 2 || !l[0].acquired.Equal(at(2)) {
+		t.Errorf("transfer left %d lots, want the two newest", len(l))
+	}
+}
@@ -0,0 +1,805 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/grishinsana/goftx"
+	"github.com/grishinsana/goftx/models"
+)
+
+// dataset is one kind of record that is exported for every account. It can be
+// downloaded from the API or rebuilt from the raw archive.
+type dataset interface {
+	export(job *exportJob) (int64, error)
+	render(job *exportJob, raw *archive) (int64, error)
+	// table describes the columns of the records.
+	table() *table
+}
+
+// csvDataset is a dataset of records that are fetched in time windows and
+// written to a CSV file, one row per record.
+type csvDataset[T any] struct {
+	// API paths, used to find the responses in the raw archive.
+	endpoints []string
+	columns   *table
+	// fetch can narrow the request with the filter, paginate drops records
+	// outside of the window.
+	fetch func(client *goftx.Client, filter *exportFilter) pageFunc[T]
+	// pageSize is the page size of the endpoint, 0 when it returns the whole
+	// history at once.
+	pageSize int
+	// paged, when set, reports whether a record came from the paginated
+	// endpoint. Records fetch merged in from elsewhere don't fill a page.
+	paged func(rec T) bool
+	// fetchMarket, when set, fetches the records of a single market. A second
+	// that fills a whole page is then fetched market by market.
+	fetchMarket func(client *goftx.Client, market string) pageFunc[T]
+	key         keyFunc[T]
+	// subject returns the coins and the market of a record for the filter.
+	subject func(rec T) (coins []string, market string)
+	// enrich, when set, completes the records before they are written, from
+	// the API or in a render from the raw archive.
+	enrich func(job *exportJob, raw *archive, recs []T) error
+	// decode, when set, reads the records of an archived page that is not a
+	// list of records.
+	decode func(page json.RawMessage) ([]T, error)
+	// values returns the row of a record, one value per column.
+	values func(rec T) []interface{}
+}
+
+func (d *csvDataset[T]) table() *table {
+	return d.columns
+}
+
+// keeps reports whether the filter keeps a record.
+func (d *csvDataset[T]) keeps(filter *exportFilter, rec T) bool {
+	t, _ := d.key(rec)
+	coins, market := d.subject(rec)
+	return filter.keeps(t, coins, market)
+}
+
+// export downloads the missing windows of the dataset with paginate and
+// appends them to the output file and the sinks.
+func (d *csvDataset[T]) export(job *exportJob) (int64, error) {
+	file, csvWriter, err := job.openCSV(d.columns.header(), true)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer file.Close()
+
+	sinks, err := job.openSinks(d.columns)
+
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64 = 0
+	p := d.pager(job)
+	from, to := job.filter.window()
+
+	err = job.state.eachWindow(job.account, job.dataset, from, to, func(w *window) error {
+		job.requested = job.requested.extend(w.start(), w.until)
+
+		return paginate(w, p, func(recs []T) error {
+			kept := make([]T, 0, len(recs))
+
+			for _, rec := range recs {
+				if d.keeps(job.filter, rec) {
+					kept = append(kept, rec)
+				}
+			}
+
+			if d.enrich != nil {
+				if err := d.enrich(job, nil, kept); err != nil {
+					return err
+				}
+			}
+
+			rows := make([][]interface{}, len(kept))
+
+			for i, rec := range kept {
+				count++
+				rows[i] = d.values(rec)
+				csvWriter.Write(formatRow(rows[i]))
+			}
+
+			csvWriter.Flush()
+
+			if err := csvWriter.Error(); err != nil {
+				return err
+			}
+
+			return sinks.write(rows)
+		})
+	})
+
+	if closeErr := sinks.close(); err == nil {
+		err = closeErr
+	}
+
+	return count, err
+}
+
+// pager returns the pages of the dataset for the account of the job, every
+// request under the rate limit.
+func (d *csvDataset[T]) pager(job *exportJob) *pager[T] {
+	limited := func(fetch pageFunc[T]) pageFunc[T] {
+		return func(start, end int64) ([]T, error) {
+			return call(job.ctx, func() ([]T, error) {
+				return fetch(start, end)
+			})
+		}
+	}
+
+	p := &pager[T]{
+		fetch: limited(d.fetch(job.client, job.filter)),
+		key:   d.key,
+		size:  d.pageSize,
+		paged: d.paged,
+	}
+
+	// A request that is already narrowed to one market can't be split further.
+	if d.fetchMarket == nil || job.filter.market() != nil {
+		return p
+	}
+
+	var live []string
+	var expired []*models.Future
+
+	// Markets with records at a time are the live markets and the futures
+	// that expired after it.
+	markets := func(at time.Time) ([]string, error) {
+		if live == nil {
+			markets, err := call(job.ctx, job.client.Markets.GetMarkets)
+
+			if err != nil {
+				return nil, err
+			}
+
+			for _, m := range markets {
+				live = append(live, m.Name)
+			}
+
+			if expired, err = call(job.ctx, job.client.Markets.GetExpiredFutures); err != nil {
+				live = nil
+				return nil, err
+			}
+		}
+
+		names := append([]string(nil), live...)
+
+		for _, f := range expired {
+			if !f.Expiry.Before(at) {
+				names = append(names, f.Name)
+			}
+		}
+
+		return names, nil
+	}
+
+	p.second = byMarket(markets, func(rec T) string {
+		_, market := d.subject(rec)
+		return market
+	}, func(market string) pageFunc[T] {
+		return limited(d.fetchMarket(job.client, market))
+	}, d.pageSize)
+
+	return p
+}
+
+// render rewrites the output file from all archived pages of the dataset that
+// the filter keeps, newest record first and every record once.
+func (d *csvDataset[T]) render(job *exportJob, raw *archive) (int64, error) {
+	var recs []T
+	seen := map[string]bool{}
+
+	for _, endpoint := range d.endpoints {
+		pages, err := raw.pages(job.account, endpoint)
+
+		if err != nil {
+			return 0, err
+		}
+
+		for _, page := range pages {
+			result, err := d.decodePage(page)
+
+			if err != nil {
+				return 0, fmt.Errorf("%s: %w", endpoint, err)
+			}
+
+			for _, rec := range result {
+				t, id := d.key(rec)
+				k := fmt.Sprintf("%d/%s", t.UnixNano(), id)
+
+				if !seen[k] && d.keeps(job.filter, rec) {
+					recs = append(recs, rec)
+				}
+
+				seen[k] = true
+			}
+		}
+	}
+
+	sort.SliceStable(recs, func(a, b int) bool {
+		ta, _ := d.key(recs[a])
+		tb, _ := d.key(recs[b])
+		return ta.After(tb)
+	})
+
+	if d.enrich != nil {
+		if err := d.enrich(job, raw, recs); err != nil {
+			return 0, err
+		}
+	}
+
+	job.full = true
+	file, csvWriter, err := job.openCSV(d.columns.header(), true)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer file.Close()
+
+	rows := make([][]interface{}, len(recs))
+
+	for i, rec := range recs {
+		rows[i] = d.values(rec)
+		csvWriter.Write(formatRow(rows[i]))
+	}
+
+	csvWriter.Flush()
+
+	if err := csvWriter.Error(); err != nil {
+		return 0, err
+	}
+
+	return int64(len(recs)), writeSinks(job, d.columns, rows)
+}
+
+func (d *csvDataset[T]) decodePage(page json.RawMessage) ([]T, error) {
+	if d.decode != nil {
+		return d.decode(page)
+	}
+
+	var result []T
+	err := json.Unmarshal(page, &result)
+	return result, err
+}
+
+// snapshotDataset is a dataset of the current state of an account, such as
+// its balances. Every run appends a snapshot stamped with the time it was
+// taken, so the file keeps the snapshots of all runs.
+type snapshotDataset[T any] struct {
+	// API path, used to find the responses in the raw archive.
+	endpoint string
+	// The first column is the time of the snapshot.
+	columns *table
+	fetch   func(client *goftx.Client) ([]T, error)
+	// subject returns the coins and the market of a record for the filter.
+	subject func(rec T) (coins []string, market string)
+	// values returns the row of a record without the time.
+	values func(rec T) []interface{}
+}
+
+func (d *snapshotDataset[T]) table() *table {
+	return d.columns
+}
+
+func (d *snapshotDataset[T]) export(job *exportJob) (int64, error) {
+	recs, err := call(job.ctx, func() ([]T, error) {
+		return d.fetch(job.client)
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return d.write(job, [][]T{recs}, []time.Time{time.Now()})
+}
+
+// render writes every archived snapshot, the newest first.
+func (d *snapshotDataset[T]) render(job *exportJob, raw *archive) (int64, error) {
+	entries, err := raw.entries(job.account, d.endpoint)
+
+	if err != nil {
+		return 0, err
+	}
+
+	var snapshots [][]T
+	var taken []time.Time
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		var resp goftx.Response
+
+		if err := json.Unmarshal(entries[i].Response, &resp); err != nil {
+			return 0, err
+		}
+
+		if !resp.Success {
+			continue
+		}
+
+		var recs []T
+
+		if err := json.Unmarshal(resp.Result, &recs); err != nil {
+			return 0, fmt.Errorf("%s: %w", d.endpoint, err)
+		}
+
+		snapshots = append(snapshots, recs)
+		taken = append(taken, entries[i].FetchedAt)
+	}
+
+	job.full = true
+	return d.write(job, snapshots, taken)
+}
+
+// write appends the snapshots taken at the given times, kept to the second.
+func (d *snapshotDataset[T]) write(job *exportJob, snapshots [][]T, taken []time.Time) (int64, error) {
+	file, csvWriter, err := job.openCSV(d.columns.header(), false)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer file.Close()
+
+	var rows [][]interface{}
+
+	for i, recs := range snapshots {
+		t := taken[i].UTC().Truncate(time.Second)
+
+		for _, rec := range recs {
+			// Snapshots are the state at the time of the run, the time range
+			// of the filter does not apply to them.
+			if !job.filter.keepsSubject(d.subject(rec)) {
+				continue
+			}
+
+			row := append([]interface{}{t}, d.values(rec)...)
+			rows = append(rows, row)
+			csvWriter.Write(formatRow(row))
+		}
+	}
+
+	csvWriter.Flush()
+
+	if err := csvWriter.Error(); err != nil {
+		return 0, err
+	}
+
+	return int64(len(rows)), writeSinks(job, d.columns, rows)
+}
+
+// writeSinks writes all rows of a dataset to the sinks of the job.
+func writeSinks(job *exportJob, t *table, rows [][]interface{}) error {
+	sinks, err := job.openSinks(t)
+
+	if err != nil {
+		return err
+	}
+
+	err = sinks.write(rows)
+
+	if closeErr := sinks.close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+var fillsDataset = &csvDataset[*models.Fill]{
+	endpoints: []string{"/fills"},
+	columns: &table{
+		name: "fills",
+		columns: []column{
+			{name: "ID", kind: kindInt},
+			{name: "BaseCurrency", kind: kindString},
+			{name: "Fee", kind: kindDecimal},
+			{name: "FeeCurrency", kind: kindString},
+			{name: "FeeRate", kind: kindDecimal},
+			{name: "Future", kind: kindString},
+			{name: "Liquidity", kind: kindString},
+			{name: "Market", kind: kindString},
+			{name: "OrderID", kind: kindInt},
+			{name: "Price", kind: kindDecimal},
+			{name: "QuoteCurrency", kind: kindString},
+			{name: "Side", kind: kindString},
+			{name: "Size", kind: kindDecimal},
+			{name: "Time", kind: kindTime},
+			{name: "TradeID", kind: kindInt},
+			{name: "Type", kind: kindString},
+		},
+		primaryKey: []string{"id"},
+		indexes:    []string{"time", "market", "base_currency", "order_id"},
+	},
+	fetch: func(client *goftx.Client, filter *exportFilter) pageFunc[*models.Fill] {
+		return fillsPage(client, filter.market())
+	},
+	pageSize: ftxPageSize,
+	fetchMarket: func(client *goftx.Client, market string) pageFunc[*models.Fill] {
+		return fillsPage(client, &market)
+	},
+	key: func(f *models.Fill) (time.Time, string) {
+		return f.Time.Time, fmt.Sprintf("%d", f.ID)
+	},
+	subject: func(f *models.Fill) ([]string, string) {
+		if f.Future != "" {
+			return []string{underlying(f.Future)}, f.Future
+		}
+
+		return []string{f.BaseCurrency, f.QuoteCurrency}, f.Market
+	},
+	values: func(f *models.Fill) []interface{} {
+		return []interface{}{
+			f.ID,
+			f.BaseCurrency,
+			f.Fee,
+			f.FeeCurrency,
+			f.FeeRate,
+			f.Future,
+			f.Liquidity,
+			f.Market,
+			f.OrderID,
+			f.Price,
+			f.QuoteCurrency,
+			f.Side,
+			f.Size,
+			f.Time.Time,
+			f.TradeID,
+			f.Type,
+		}
+	},
+}
+
+// fillsPage fetches the fills of a market, or of all markets when market is nil.
+func fillsPage(client *goftx.Client, market *string) pageFunc[*models.Fill] {
+	return func(start, end int64) ([]*models.Fill, error) {
+		startTime := int(start)
+		endTime := int(end)
+
+		return client.Fills.Fills(&models.FillsParams{
+			Market:    market,
+			StartTime: &startTime,
+			EndTime:   &endTime,
+		})
+	}
+}
+
+var withdrawalsDataset = &csvDataset[*models.WithdrawalHistory]{
+	endpoints: []string{"/wallet/withdrawals"},
+	columns: &table{
+		name: "withdrawals",
+		columns: []column{
+			{name: "Coin", kind: kindString},
+			{name: "Address", kind: kindString},
+			{name: "Tag", kind: kindString},
+			{name: "Fee", kind: kindDecimal},
+			{name: "ID", kind: kindInt},
+			{name: "Size", kind: kindDecimal},
+			{name: "Status", kind: kindString},
+			{name: "Time", kind: kindTime},
+			{name: "Method", kind: kindString},
+			{name: "Txid", kind: kindString},
+			{name: "Notes", kind: kindString},
+		},
+		primaryKey: []string{"id"},
+		indexes:    []string{"time", "coin"},
+	},
+	fetch: func(client *goftx.Client, _ *exportFilter) pageFunc[*models.WithdrawalHistory] {
+		return client.GetWithdrawalHistory
+	},
+	pageSize: ftxPageSize,
+	key: func(f *models.WithdrawalHistory) (time.Time, string) {
+		return f.Time, fmt.Sprintf("%d", f.ID)
+	},
+	subject: func(f *models.WithdrawalHistory) ([]string, string) {
+		return []string{f.Coin}, ""
+	},
+	values: func(f *models.WithdrawalHistory) []interface{} {
+		return []interface{}{
+			f.Coin,
+			f.Address,
+			f.Tag,
+			f.Fee,
+			f.ID,
+			f.Size,
+			f.Status,
+			f.Time,
+			f.Method,
+			f.Txid,
+			f.Notes,
+		}
+	},
+}
+
+var depositsDataset = &csvDataset[*models.DepositHistory]{
+	endpoints: []string{"/wallet/deposits"},
+	columns: &table{
+		name: "deposits",
+		columns: []column{
+			{name: "Coin", kind: kindString},
+			{name: "Confirmations", kind: kindInt},
+			{name: "ConfirmedTime", kind: kindTime},
+			{name: "Fee", kind: kindDecimal},
+			{name: "ID", kind: kindInt},
+			{name: "SentTime", kind: kindTime},
+			{name: "Size", kind: kindDecimal},
+			{name: "Status", kind: kindString},
+			{name: "Time", kind: kindTime},
+			{name: "Txid", kind: kindString},
+			{name: "Notes", kind: kindString},
+		},
+		primaryKey: []string{"id"},
+		indexes:    []string{"time", "coin"},
+	},
+	fetch: func(client *goftx.Client, _ *exportFilter) pageFunc[*models.DepositHistory] {
+		return client.GetDepositHistory
+	},
+	pageSize: ftxPageSize,
+	key: func(f *models.DepositHistory) (time.Time, string) {
+		return f.Time, fmt.Sprintf("%d", f.ID)
+	},
+	subject: func(f *models.DepositHistory) ([]string, string) {
+		return []string{f.Coin}, ""
+	},
+	values: func(f *models.DepositHistory) []interface{} {
+		return []interface{}{
+			f.Coin,
+			f.Confirmations,
+			f.ConfirmedTime,
+			f.Fee,
+			f.ID,
+			f.SentTime,
+			f.Size,
+			f.Status,
+			f.Time,
+			f.Txid,
+			f.Notes,
+		}
+	},
+}
+
+// Rebates are daily, one record per referred subaccount and day.
+var rebatesDataset = &csvDataset[*models.ReferralRebateHistory]{
+	endpoints: []string{"/referral_rebate_history"},
+	columns: &table{
+		name: "referral_rebates",
+		columns: []column{
+			// The referred subaccount, not the account the rebate was paid to.
+			{name: "Subaccount", kind: kindString, field: "referred_subaccount"},
+			{name: "Size", kind: kindDecimal},
+			{name: "Day", kind: kindTime},
+		},
+		primaryKey: []string{"subaccount", "referred_subaccount", "day"},
+		indexes:    []string{"day"},
+	},
+	fetch: func(client *goftx.Client, _ *exportFilter) pageFunc[*models.ReferralRebateHistory] {
+		return client.GetReferralRebateHistory
+	},
+	pageSize: ftxPageSize,
+	key: func(f *models.ReferralRebateHistory) (time.Time, string) {
+		return f.Day, f.Subaccount
+	},
+	// Rebates are paid in USD.
+	subject: func(f *models.ReferralRebateHistory) ([]string, string) {
+		return []string{"USD"}, ""
+	},
+	values: func(f *models.ReferralRebateHistory) []interface{} {
+		return []interface{}{
+			f.Subaccount,
+			f.Size,
+			f.Day,
+		}
+	},
+}
+
+var fundingDataset = &csvDataset[*models.FundingPayment]{
+	endpoints: []string{"/funding_payments"},
+	columns: &table{
+		name: "funding_payments",
+		columns: []column{
+			{name: "Future", kind: kindString},
+			{name: "ID", kind: kindInt},
+			{name: "Payment", kind: kindDecimal},
+			{name: "Time", kind: kindTime},
+		},
+		primaryKey: []string{"id"},
+		indexes:    []string{"time", "future"},
+	},
+	fetch: func(client *goftx.Client, _ *exportFilter) pageFunc[*models.FundingPayment] {
+		return client.GetFundingPayments
+	},
+	pageSize: ftxPageSize,
+	key: func(f *models.FundingPayment) (time.Time, string) {
+		return f.Time, fmt.Sprintf("%d", f.ID)
+	},
+	subject: func(f *models.FundingPayment) ([]string, string) {
+		return []string{underlying(f.Future)}, f.Future
+	},
+	values: func(f *models.FundingPayment) []interface{} {
+		return []interface{}{
+			f.Future,
+			f.ID,
+			f.Payment,
+			f.Time,
+		}
+	},
+}
+
+// Borrow and lending records have no ID, there is one record per coin and
+// hour.
+var borrowDataset = &csvDataset[*models.BorrowHistory]{
+	endpoints: []string{"/spot_margin/borrow_history"},
+	columns: &table{
+		name: "borrow_history",
+		columns: []column{
+			{name: "Coin", kind: kindString},
+			{name: "Cost", kind: kindDecimal},
+			{name: "Rate", kind: kindDecimal},
+			{name: "Size", kind: kindDecimal},
+			{name: "Time", kind: kindTime},
+		},
+		primaryKey: []string{"subaccount", "coin", "time"},
+		indexes:    []string{"time", "coin"},
+	},
+	fetch: func(client *goftx.Client, _ *exportFilter) pageFunc[*models.BorrowHistory] {
+		return client.SpotMargin.GetBorrowHistory
+	},
+	pageSize: ftxPageSize,
+	key: func(f *models.BorrowHistory) (time.Time, string) {
+		return f.Time, f.Coin
+	},
+	subject: func(f *models.BorrowHistory) ([]string, string) {
+		return []string{f.Coin}, ""
+	},
+	values: func(f *models.BorrowHistory) []interface{} {
+		return []interface{}{
+			f.Coin,
+			f.Cost,
+			f.Rate,
+			f.Size,
+			f.Time,
+		}
+	},
+}
+
+var lendingDataset = &csvDataset[*models.LendingHistory]{
+	endpoints: []string{"/spot_margin/lending_history"},
+	columns: &table{
+		name: "lending_history",
+		columns: []column{
+			{name: "Coin", kind: kindString},
+			{name: "Proceeds", kind: kindDecimal},
+			{name: "Rate", kind: kindDecimal},
+			{name: "Size", kind: kindDecimal},
+			{name: "Time", kind: kindTime},
+		},
+		primaryKey: []string{"subaccount", "coin", "time"},
+		indexes:    []string{"time", "coin"},
+	},
+	fetch: func(client *goftx.Client, _ *exportFilter) pageFunc[*models.LendingHistory] {
+		return client.SpotMargin.GetLendingHistory
+	},
+	pageSize: ftxPageSize,
+	key: func(f *models.LendingHistory) (time.Time, string) {
+		return f.Time, f.Coin
+	},
+	subject: func(f *models.LendingHistory) ([]string, string) {
+		return []string{f.Coin}, ""
+	},
+	values: func(f *models.LendingHistory) []interface{} {
+		return []interface{}{
+			f.Coin,
+			f.Proceeds,
+			f.Rate,
+			f.Size,
+			f.Time,
+		}
+	},
+}
+
+// accountDetails is a snapshot of the account, written as JSON.
+type accountDetails struct{}
+
+// accountTable keeps the latest snapshot of every account, the positions are
+// kept as JSON.
+var accountTable = &table{
+	name: "account_details",
+	columns: []column{
+		{name: "Username", kind: kindString},
+		{name: "Collateral", kind: kindDecimal},
+		{name: "FreeCollateral", kind: kindDecimal},
+		{name: "TotalAccountValue", kind: kindDecimal},
+		{name: "TotalPositionSize", kind: kindDecimal},
+		{name: "InitialMarginRequirement", kind: kindDecimal},
+		{name: "MaintenanceMarginRequirement", kind: kindDecimal},
+		{name: "MarginFraction", kind: kindDecimal},
+		{name: "OpenMarginFraction", kind: kindDecimal},
+		{name: "Leverage", kind: kindDecimal},
+		{name: "MakerFee", kind: kindDecimal},
+		{name: "TakerFee", kind: kindDecimal},
+		{name: "BackstopProvider", kind: kindBool},
+		{name: "Liquidating", kind: kindBool},
+		{name: "Positions", kind: kindString},
+	},
+	primaryKey: []string{"subaccount"},
+}
+
+func (accountDetails) table() *table {
+	return accountTable
+}
+
+func (accountDetails) export(job *exportJob) (int64, error) {
+	acc, err := call(job.ctx, job.client.GetAccountInformation)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return 1, writeAccountDetails(job, acc)
+}
+
+// render writes the newest archived snapshot.
+func (accountDetails) render(job *exportJob, raw *archive) (int64, error) {
+	pages, err := raw.pages(job.account, "/account")
+
+	if err != nil || len(pages) == 0 {
+		return 0, err
+	}
+
+	var acc *models.AccountInformation
+
+	if err := json.Unmarshal(pages[len(pages)-1], &acc); err != nil {
+		return 0, err
+	}
+
+	return 1, writeAccountDetails(job, acc)
+}
+
+func writeAccountDetails(job *exportJob, acc *models.AccountInformation) error {
+	data, err := json.MarshalIndent(acc, "", " ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(job.outFile, data, 0777); err != nil {
+		return err
+	}
+
+	if len(job.sinks) == 0 {
+		return nil
+	}
+
+	// The snapshot replaces the one of earlier runs.
+	job.restarted = true
+
+	positions, err := json.Marshal(acc.Positions)
+	if err != nil {
+		return err
+	}
+
+	return writeSinks(job, accountTable, [][]interface{}{{
+		acc.Username,
+		acc.Collateral,
+		acc.FreeCollateral,
+		acc.TotalAccountValue,
+		acc.TotalPositionSize,
+		acc.InitialMarginRequirement,
+		acc.MaintenanceMarginRequirement,
+		acc.MarginFraction,
+		acc.OpenMarginFraction,
+		acc.Leverage,
+		acc.MakerFee,
+		acc.TakerFee,
+		acc.BackstopProvider,
+		acc.Liquidating,
+		string(positions),
+	}})
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// exportFilter limits an export to a time range, subaccounts, coins and
+// markets. The time range and a single market are passed on to the API,
+// everything else is applied while the records are written. A nil filter
+// keeps everything.
+type exportFilter struct {
+	// Records from From up to, but not including, To.
+	From *time.Time `json:"from,omitempty"`
+	To   *time.Time `json:"to,omitempty"`
+	// Glob patterns of account labels, "Main" is the main account.
+	Subaccounts        []string `json:"subaccounts,omitempty"`
+	ExcludeSubaccounts []string `json:"excludeSubaccounts,omitempty"`
+	Coins              []string `json:"coins,omitempty"`
+	ExcludeCoins       []string `json:"excludeCoins,omitempty"`
+	Markets            []string `json:"markets,omitempty"`
+	ExcludeMarkets     []string `json:"excludeMarkets,omitempty"`
+}
+
+// newExportFilter checks the filter and returns nil when it keeps
+// everything.
+func newExportFilter(f *exportFilter) (*exportFilter, error) {
+	if f.From != nil && f.To != nil && !f.From.Before(*f.To) {
+		return nil, fmt.Errorf("-from %s is not before -to %s", f.From.Format(time.RFC3339), f.To.Format(time.RFC3339))
+	}
+
+	for _, pattern := range append(append([]string{}, f.Subaccounts...), f.ExcludeSubaccounts...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid subaccount pattern %q", pattern)
+		}
+	}
+
+	if reflect.DeepEqual(f, &exportFilter{}) {
+		return nil, nil
+	}
+
+	return f, nil
+}
+
+// splitList splits a comma separated flag value, upper casing the items when
+// upper is set.
+func splitList(s string, upper bool) []string {
+	var items []string
+
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+
+		if upper {
+			item = strings.ToUpper(item)
+		}
+
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+func (f *exportFilter) equal(o *exportFilter) bool {
+	if f == nil || o == nil {
+		return f == o
+	}
+
+	return reflect.DeepEqual(f, o)
+}
+
+func (f *exportFilter) String() string {
+	if f == nil {
+		return "no filter"
+	}
+
+	var parts []string
+
+	if f.From != nil {
+		parts = append(parts, "from "+f.From.Format(time.RFC3339))
+	}
+
+	if f.To != nil {
+		parts = append(parts, "to "+f.To.Format(time.RFC3339))
+	}
+
+	list := func(name string, items []string) {
+		if len(items) > 0 {
+			parts = append(parts, name+" "+strings.Join(items, ","))
+		}
+	}
+
+	list("subaccounts", f.Subaccounts)
+	list("excluding subaccounts", f.ExcludeSubaccounts)
+	list("coins", f.Coins)
+	list("excluding coins", f.ExcludeCoins)
+	list("markets", f.Markets)
+	list("excluding markets", f.ExcludeMarkets)
+
+	return strings.Join(parts, ", ")
+}
+
+// window returns the time range to request from the API, zero times are
+// unbounded.
+func (f *exportFilter) window() (from, to time.Time) {
+	if f == nil {
+		return
+	}
+
+	if f.From != nil {
+		from = *f.From
+	}
+
+	if f.To != nil {
+		to = *f.To
+	}
+
+	return
+}
+
+// market returns the market to request from the API, when exactly one is
+// included.
+func (f *exportFilter) market() *string {
+	if f == nil || len(f.Markets) != 1 {
+		return nil
+	}
+
+	return &f.Markets[0]
+}
+
+func globMatch(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, s); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func listed(items []string, s string) bool {
+	for _, item := range items {
+		if item == strings.ToUpper(s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// account reports whether the account with the label is exported.
+func (f *exportFilter) account(label string) bool {
+	if f == nil {
+		return true
+	}
+
+	if len(f.Subaccounts) > 0 && !globMatch(f.Subaccounts, label) {
+		return false
+	}
+
+	return !globMatch(f.ExcludeSubaccounts, label)
+}
+
+// keeps reports whether a record is written. A record is kept when one of its
+// coins is included and none is excluded. The market filters only apply to
+// records of a market, fills and funding payments.
+func (f *exportFilter) keeps(t time.Time, coins []string, market string) bool {
+	if f == nil {
+		return true
+	}
+
+	if (f.From != nil && t.Before(*f.From)) || (f.To != nil && !t.Before(*f.To)) {
+		return false
+	}
+
+	return f.keepsSubject(coins, market)
+}
+
+// keepsSubject applies the coin and market filters without the time range.
+func (f *exportFilter) keepsSubject(coins []string, market string) bool {
+	if f == nil {
+		return true
+	}
+
+	if len(coins) > 0 {
+		included := len(f.Coins) == 0
+
+		for _, coin := range coins {
+			if listed(f.ExcludeCoins, coin) {
+				return false
+			}
+
+			included = included || listed(f.Coins, coin)
+		}
+
+		if !included {
+			return false
+		}
+	}
+
+	if market != "" {
+		if len(f.Markets) > 0 && !listed(f.Markets, market) {
+			return false
+		}
+
+		if listed(f.ExcludeMarkets, market) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// underlying returns the coin of a future, "BTC" for "BTC-PERP".
+func underlying(future string) string {
+	coin, _, _ := strings.Cut(future, "-")
+	return coin
+}
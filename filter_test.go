@@ -0,0 +1,146 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func timeAt(minutes int) *time.Time {
+	t := at(minutes)
+	return &t
+}
+
+func TestNewExportFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  exportFilter
+		wantNil bool
+		wantErr bool
+	}{
+		{name: "empty", wantNil: true},
+		{name: "time range", filter: exportFilter{From: timeAt(0), To: timeAt(1)}},
+		{name: "empty time range", filter: exportFilter{From: timeAt(1), To: timeAt(1)}, wantErr: true},
+		{name: "reversed time range", filter: exportFilter{From: timeAt(2), To: timeAt(1)}, wantErr: true},
+		{name: "subaccount pattern", filter: exportFilter{Subaccounts: []string{"bot-*"}}},
+		{name: "invalid subaccount pattern", filter: exportFilter{ExcludeSubaccounts: []string{"bot-["}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newExportFilter(&tt.filter)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && (f == nil) != tt.wantNil {
+				t.Errorf("filter = %v, want nil %v", f, tt.wantNil)
+			}
+		})
+	}
+}
+
+func TestFilterKeeps(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter *exportFilter
+		time   int
+		coins  []string
+		market string
+		want   bool
+	}{
+		{name: "nil filter", coins: []string{"BTC"}, market: "BTC/USD", want: true},
+		{name: "before from", filter: &exportFilter{From: timeAt(10)}, time: 9, want: false},
+		{name: "at from", filter: &exportFilter{From: timeAt(10)}, time: 10, want: true},
+		{name: "before to", filter: &exportFilter{To: timeAt(10)}, time: 9, want: true},
+		{name: "at to", filter: &exportFilter{To: timeAt(10)}, time: 10, want: false},
+		{name: "inside range", filter: &exportFilter{From: timeAt(0), To: timeAt(10)}, time: 5, want: true},
+		{name: "included coin", filter: &exportFilter{Coins: []string{"BTC"}}, coins: []string{"BTC", "USD"}, want: true},
+		{name: "coin not included", filter: &exportFilter{Coins: []string{"BTC"}}, coins: []string{"ETH", "USD"}, want: false},
+		{name: "lower case coin", filter: &exportFilter{Coins: []string{"BTC"}}, coins: []string{"btc"}, want: true},
+		{name: "lower case excluded coin", filter: &exportFilter{ExcludeCoins: []string{"USDT"}}, coins: []string{"usdt"}, want: false},
+		{name: "exclusion wins over inclusion", filter: &exportFilter{Coins: []string{"BTC"}, ExcludeCoins: []string{"USD"}}, coins: []string{"BTC", "USD"}, want: false},
+		{name: "same coin included and excluded", filter: &exportFilter{Coins: []string{"BTC"}, ExcludeCoins: []string{"BTC"}}, coins: []string{"BTC"}, want: false},
+		{name: "record without coins", filter: &exportFilter{Coins: []string{"BTC"}}, want: true},
+		{name: "included market", filter: &exportFilter{Markets: []string{"BTC-PERP"}}, market: "btc-perp", want: true},
+		{name: "market not included", filter: &exportFilter{Markets: []string{"BTC-PERP"}}, market: "ETH-PERP", want: false},
+		{name: "excluded market wins", filter: &exportFilter{Markets: []string{"BTC-PERP"}, ExcludeMarkets: []string{"BTC-PERP"}}, market: "BTC-PERP", want: false},
+		{name: "record without market", filter: &exportFilter{Markets: []string{"BTC-PERP"}}, coins: []string{"USD"}, want: true},
+		{name: "coin and market", filter: &exportFilter{Coins: []string{"BTC"}, ExcludeMarkets: []string{"BTC/USDT"}}, coins: []string{"BTC", "USDT"}, market: "BTC/USDT", want: false},
+		{name: "time before subject", filter: &exportFilter{From: timeAt(10), Coins: []string{"BTC"}}, time: 0, coins: []string{"BTC"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.keeps(at(tt.time), tt.coins, tt.market); got != tt.want {
+				t.Errorf("keeps = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterAccount(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter *exportFilter
+		label  string
+		want   bool
+	}{
+		{name: "nil filter", label: "Main", want: true},
+		{name: "no subaccount filter", filter: &exportFilter{Coins: []string{"BTC"}}, label: "bot-1", want: true},
+		{name: "included", filter: &exportFilter{Subaccounts: []string{"Main"}}, label: "Main", want: true},
+		{name: "not included", filter: &exportFilter{Subaccounts: []string{"Main"}}, label: "bot-1", want: false},
+		{name: "glob", filter: &exportFilter{Subaccounts: []string{"bot-*"}}, label: "bot-1", want: true},
+		{name: "glob is case sensitive", filter: &exportFilter{Subaccounts: []string{"bot-*"}}, label: "Bot-1", want: false},
+		{name: "glob does not match main", filter: &exportFilter{Subaccounts: []string{"*-1"}}, label: "Main", want: false},
+		{name: "excluded", filter: &exportFilter{ExcludeSubaccounts: []string{"bot-?"}}, label: "bot-1", want: false},
+		{name: "not excluded", filter: &exportFilter{ExcludeSubaccounts: []string{"bot-?"}}, label: "bot-10", want: true},
+		{name: "exclusion wins over inclusion", filter: &exportFilter{Subaccounts: []string{"bot-*"}, ExcludeSubaccounts: []string{"bot-2"}}, label: "bot-2", want: false},
+		{name: "included next to exclusion", filter: &exportFilter{Subaccounts: []string{"bot-*"}, ExcludeSubaccounts: []string{"bot-2"}}, label: "bot-1", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.account(tt.label); got != tt.want {
+				t.Errorf("account(%q) = %v, want %v", tt.label, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		filter   *exportFilter
+		market   string
+		from, to time.Time
+	}{
+		{name: "nil filter"},
+		{name: "no market", filter: &exportFilter{Coins: []string{"BTC"}}},
+		{name: "one market", filter: &exportFilter{Markets: []string{"BTC-PERP"}}, market: "BTC-PERP"},
+		{name: "two markets", filter: &exportFilter{Markets: []string{"BTC-PERP", "ETH-PERP"}}},
+		{name: "excluded market", filter: &exportFilter{ExcludeMarkets: []string{"BTC-PERP"}}},
+		{name: "from", filter: &exportFilter{From: timeAt(5)}, from: at(5)},
+		{name: "range", filter: &exportFilter{From: timeAt(5), To: timeAt(10)}, from: at(5), to: at(10)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			market := ""
+
+			if m := tt.filter.market(); m != nil {
+				market = *m
+			}
+
+			if market != tt.market {
+				t.Errorf("market = %q, want %q", market, tt.market)
+			}
+
+			from, to := tt.filter.window()
+
+			if !from.Equal(tt.from) || !to.Equal(tt.to) {
+				t.Errorf("window = %v, %v, want %v, %v", from, to, tt.from, tt.to)
+			}
+		})
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/shopspring/decimal"
+)
+
+// formatFile keeps the text format of the CSV files of an output directory,
+// so they are read back and appended to the way they were written.
+const formatFile = ".ftx-export-format.json"
+
+// Timestamp formats of the CSV files.
+const (
+	// The format of time.Time.String, "2022-03-01 10:00:00 +0000 UTC".
+	timeFormatGo      = "go"
+	timeFormatRFC3339 = "rfc3339"
+	// Seconds since the epoch, with a fraction for sub-second timestamps.
+	timeFormatUnix = "unix"
+	// Milliseconds since the epoch.
+	timeFormatUnixMs = "unixms"
+)
+
+var timeFormats = []string{timeFormatGo, timeFormatRFC3339, timeFormatUnix, timeFormatUnixMs}
+
+// textFormat decides how times and numbers are written to the CSV files and
+// reports. Typed outputs like SQLite and Parquet and the import formats of
+// other tools do not use it.
+type textFormat struct {
+	Time string `json:"time"`
+	// IANA name of the zone times are converted to, UTC when empty.
+	Timezone         string `json:"timezone,omitempty"`
+	DecimalSeparator string `json:"decimalSeparator"`
+	Delimiter        string `json:"delimiter"`
+
+	loc *time.Location
+}
+
+func defaultTextFormat() *textFormat {
+	return &textFormat{Time: timeFormatGo, DecimalSeparator: ".", Delimiter: ",", loc: time.UTC}
+}
+
+// outFormat is the format of the output directory the command works on.
+var outFormat = defaultTextFormat()
+
+// newTextFormat checks the settings and fills in the defaults. The delimiter
+// defaults to a semicolon when decimals use a comma.
+func newTextFormat(timeFormat, timezone, decimalSeparator, delimiter string) (*textFormat, error) {
+	f := &textFormat{Time: strings.ToLower(timeFormat), Timezone: timezone, DecimalSeparator: decimalSeparator, Delimiter: delimiter}
+
+	switch f.Time {
+	case "", "default":
+		f.Time = timeFormatGo
+	case "iso8601", "iso":
+		f.Time = timeFormatRFC3339
+	}
+
+	if f.DecimalSeparator == "" {
+		f.DecimalSeparator = "."
+	}
+
+	switch f.Delimiter {
+	case "":
+		f.Delimiter = ","
+
+		if f.DecimalSeparator == "," {
+			f.Delimiter = ";"
+		}
+	case "tab", `\t`:
+		f.Delimiter = "\t"
+	}
+
+	if err := f.init(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// init validates the format and loads its timezone.
+func (f *textFormat) init() error {
+	known := false
+
+	for _, name := range timeFormats {
+		known = known || f.Time == name
+	}
+
+	if !known {
+		return fmt.Errorf("unknown time format %q, available: %s", f.Time, strings.Join(timeFormats, ", "))
+	}
+
+	if f.DecimalSeparator != "." && f.DecimalSeparator != "," {
+		return fmt.Errorf("decimal separator must be . or , not %q", f.DecimalSeparator)
+	}
+
+	delimiter, size := utf8.DecodeRuneInString(f.Delimiter)
+
+	if size == 0 || size != len(f.Delimiter) || delimiter == '"' || delimiter == '\r' || delimiter == '\n' {
+		return fmt.Errorf("invalid CSV delimiter %q", f.Delimiter)
+	}
+
+	if f.Delimiter == f.DecimalSeparator {
+		return errors.New("the CSV delimiter and the decimal separator must differ")
+	}
+
+	f.loc = time.UTC
+
+	if f.Timezone != "" && f.Timezone != "UTC" {
+		loc, err := time.LoadLocation(f.Timezone)
+
+		if err != nil {
+			return fmt.Errorf("unknown timezone %q: %w", f.Timezone, err)
+		}
+
+		f.loc = loc
+	}
+
+	return nil
+}
+
+func (f *textFormat) equal(o *textFormat) bool {
+	return f.Time == o.Time && f.loc.String() == o.loc.String() && f.DecimalSeparator == o.DecimalSeparator && f.Delimiter == o.Delimiter
+}
+
+func (f *textFormat) String() string {
+	return fmt.Sprintf("%s times in %s, decimal separator %q, delimiter %q", f.Time, f.loc, f.DecimalSeparator, f.Delimiter)
+}
+
+// time formats a timestamp. Zero times are empty, except in the go format
+// which always wrote them.
+func (f *textFormat) time(t time.Time) string {
+	if f.Time != timeFormatGo && t.IsZero() {
+		return ""
+	}
+
+	// Zero times stay in UTC, the historic offsets of zones have seconds the
+	// go format drops.
+	if f.Timezone != "" && !t.IsZero() {
+		t = t.In(f.loc)
+	}
+
+	switch f.Time {
+	case timeFormatRFC3339:
+		return t.Format(time.RFC3339Nano)
+	case timeFormatUnix:
+		return f.decimal(decimal.New(t.UnixNano(), -9))
+	case timeFormatUnixMs:
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	}
+
+	// Round drops the monotonic clock reading.
+	return t.Round(0).String()
+}
+
+// parseTime is the inverse of time.
+func (f *textFormat) parseTime(s string) (time.Time, error) {
+	if f.Time != timeFormatGo && s == "" {
+		return time.Time{}, nil
+	}
+
+	switch f.Time {
+	case timeFormatRFC3339:
+		return time.Parse(time.RFC3339Nano, s)
+	case timeFormatUnix:
+		d, err := f.parseDecimal(s)
+
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		return time.Unix(0, d.Shift(9).IntPart()).In(f.loc), nil
+	case timeFormatUnixMs:
+		ms, err := strconv.ParseInt(s, 10, 64)
+
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		return time.UnixMilli(ms).In(f.loc), nil
+	}
+
+	if i := strings.Index(s, " m="); i >= 0 {
+		s = s[:i]
+	}
+
+	t, err := time.Parse("2006-01-02 15:04:05.999999999 -0700 MST", s)
+
+	// Zones without an abbreviation are written as their offset, "-03".
+	if i := strings.LastIndex(s, " "); err != nil && i > 0 {
+		if t, err2 := time.Parse("2006-01-02 15:04:05.999999999 -0700", s[:i]); err2 == nil {
+			return t, nil
+		}
+	}
+
+	return t, err
+}
+
+func (f *textFormat) decimal(d decimal.Decimal) string {
+	return f.localize(d.String())
+}
+
+// fixed formats a decimal with a fixed number of places, for amounts of money.
+func (f *textFormat) fixed(d decimal.Decimal, places int32) string {
+	return f.localize(d.StringFixed(places))
+}
+
+func (f *textFormat) localize(s string) string {
+	if f.DecimalSeparator == "." {
+		return s
+	}
+
+	return strings.Replace(s, ".", f.DecimalSeparator, 1)
+}
+
+func (f *textFormat) parseDecimal(s string) (decimal.Decimal, error) {
+	if f.DecimalSeparator != "." {
+		s = strings.Replace(s, f.DecimalSeparator, ".", 1)
+	}
+
+	return decimal.NewFromString(s)
+}
+
+func (f *textFormat) delimiter() rune {
+	r, _ := utf8.DecodeRuneInString(f.Delimiter)
+	return r
+}
+
+func (f *textFormat) csvWriter(w io.Writer) *csv.Writer {
+	csvWriter := csv.NewWriter(w)
+	csvWriter.Comma = f.delimiter()
+	return csvWriter
+}
+
+func (f *textFormat) csvReader(r io.Reader) *csv.Reader {
+	csvReader := csv.NewReader(r)
+	csvReader.Comma = f.delimiter()
+	return csvReader
+}
+
+// loadTextFormat returns the format of the CSV files in dir, the default for
+// directories written before the format was configurable.
+func loadTextFormat(dir string) (*textFormat, error) {
+	data, err := os.ReadFile(filepath.Join(dir, formatFile))
+
+	if errors.Is(err, os.ErrNotExist) {
+		return defaultTextFormat(), nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	f := &textFormat{}
+
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("%s: %w", formatFile, err)
+	}
+
+	if err := f.init(); err != nil {
+		return nil, fmt.Errorf("%s: %w", formatFile, err)
+	}
+
+	return f, nil
+}
+
+// useTextFormat makes the format of dir the format of the command.
+func useTextFormat(dir string) error {
+	f, err := loadTextFormat(dir)
+
+	if err != nil {
+		return err
+	}
+
+	outFormat = f
+	return nil
+}
+
+// setTextFormat decides the format an export or render writes to dir. Without
+// a requested format the format of dir is kept. Files that are appended to
+// cannot change their format, which needs a full download or a render.
+func setTextFormat(dir string, requested *textFormat, rewrite bool) error {
+	current, err := loadTextFormat(dir)
+
+	if err != nil {
+		return err
+	}
+
+	if requested == nil {
+		outFormat = current
+		return nil
+	}
+
+	if !rewrite && !requested.equal(current) {
+		existing, err := filepath.Glob(filepath.Join(dir, "*.csv"))
+
+		if err != nil {
+			return err
+		}
+
+		if len(existing) > 0 {
+			return fmt.Errorf("the files in %s are written with %s, run with -full or render to change the format", dir, current)
+		}
+	}
+
+	outFormat = requested
+
+	data, err := json.MarshalIndent(requested, "", " ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, formatFile), data, 0666)
+}
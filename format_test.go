@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestFormatValueRoundTrip(t *testing.T) {
+	formats := []struct {
+		name                                        string
+		time, timezone, decimalSeparator, delimiter string
+	}{
+		{"default", "", "", "", ""},
+		{"go in a zone without abbreviation", "go", "America/Sao_Paulo", "", ""},
+		{"rfc3339 in Berlin", "rfc3339", "Europe/Berlin", "", ""},
+		{"unix with decimal comma", "unix", "", ",", ""},
+		{"unixms in Tokyo", "unixms", "Asia/Tokyo", ",", "tab"},
+	}
+
+	values := []struct {
+		name  string
+		kind  columnKind
+		value interface{}
+	}{
+		{"int", kindInt, int64(-42)},
+		{"decimal", kindDecimal, dec("-1234.5678")},
+		{"small decimal", kindDecimal, dec("0.00000001")},
+		{"time", kindTime, time.Date(2022, 3, 1, 10, 0, 0, 123000000, time.UTC)},
+		{"zero time", kindTime, time.Time{}},
+		{"bool", kindBool, true},
+		{"string", kindString, "BTC-PERP"},
+		{"delimiters in a string", kindString, "a,b;c\td \"e\""},
+	}
+
+	defer func(f *textFormat) { outFormat = f }(outFormat)
+
+	for _, ff := range formats {
+		f, err := newTextFormat(ff.time, ff.timezone, ff.decimalSeparator, ff.delimiter)
+
+		if err != nil {
+			t.Fatalf("%s: %v", ff.name, err)
+		}
+
+		outFormat = f
+
+		t.Run(ff.name+"/csv row", func(t *testing.T) {
+			tbl := &table{name: "test"}
+			row := make([]interface{}, len(values))
+
+			for i, v := range values {
+				tbl.columns = append(tbl.columns, column{name: fmt.Sprintf("Column%d", i), kind: v.kind})
+				row[i] = v.value
+			}
+
+			var buf bytes.Buffer
+			w := outFormat.csvWriter(&buf)
+			w.Write(tbl.header())
+			w.Write(formatRow(row))
+			w.Flush()
+
+			recs, err := readRecords(&buf, tbl)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, c := range tbl.columns {
+				if got := recs[0][c.fieldName()]; !sameValue(got, row[i]) {
+					t.Errorf("%s = %v, want %v", values[i].name, got, row[i])
+				}
+			}
+		})
+
+		for _, v := range values {
+			t.Run(ff.name+"/"+v.name, func(t *testing.T) {
+				s := formatValue(v.value)
+				got, err := parseValue(v.kind, s)
+
+				if err != nil {
+					t.Fatalf("parseValue(%q) = %v", s, err)
+				}
+
+				if !sameValue(got, v.value) {
+					t.Errorf("parseValue(formatValue(%v)) = %v, written as %q", v.value, got, s)
+				}
+			})
+		}
+	}
+}
+
+func sameValue(a, b interface{}) bool {
+	switch b := b.(type) {
+	case time.Time:
+		a, ok := a.(time.Time)
+		return ok && a.Equal(b)
+	case decimal.Decimal:
+		a, ok := a.(decimal.Decimal)
+		return ok && a.Equal(b)
+	}
+
+	return a == b
+}
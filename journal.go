@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kataras/golog"
+	"github.com/shopspring/decimal"
+)
+
+// journalAccounts are the accounts the postings of a journal go to.
+type journalAccounts struct {
+	// Counter accounts of deposits and withdrawals outside of FTX.
+	deposits    string
+	withdrawals string
+}
+
+// posting is one line of a journal transaction. A posting with a total price
+// is one side of a swap, priced in the commodity of the other side.
+type posting struct {
+	account        string
+	amount         decimal.Decimal
+	commodity      string
+	totalPrice     decimal.Decimal
+	totalCommodity string
+}
+
+// journalTxn is a balanced transaction, the amounts of every commodity add up
+// to zero.
+type journalTxn struct {
+	time      time.Time
+	narration string
+	reference string
+	dataset   string
+	postings  []*posting
+}
+
+// journalFormat writes transactions in the syntax of a plain text accounting
+// tool.
+type journalFormat struct {
+	name string
+	ext  string
+	// write writes the accounts opened at their first use and the
+	// transactions.
+	write func(w io.Writer, opened []openedAccount, txns []*journalTxn)
+}
+
+type openedAccount struct {
+	name string
+	date time.Time
+}
+
+var journalFormats = []*journalFormat{
+	{name: "beancount", ext: ".beancount", write: writeBeancount},
+	{name: "ledger", ext: ".journal", write: writeLedgerJournal},
+}
+
+func parseJournalFormats(list string) ([]*journalFormat, error) {
+	var formats []*journalFormat
+
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		if name == "" {
+			continue
+		}
+
+		if name == "hledger" {
+			name = "ledger"
+		}
+
+		var found *journalFormat
+
+		for _, f := range journalFormats {
+			if f.name == name {
+				found = f
+			}
+		}
+
+		if found == nil {
+			return nil, fmt.Errorf("unknown journal format %q, available: beancount, ledger", name)
+		}
+
+		formats = append(formats, found)
+	}
+
+	return formats, nil
+}
+
+// accountName turns a subaccount nickname or coin into an account name
+// component. Components start with a capital letter or digit and only hold
+// letters, digits and dashes.
+func accountName(s string) string {
+	var b strings.Builder
+
+	for _, r := range s {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('-')
+		}
+	}
+
+	name := b.String()
+
+	if name == "" || name[0] == '-' {
+		return "X" + name
+	}
+
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// commodity turns an FTX coin into a commodity name both tools accept, coins
+// that start with a digit get an X in front.
+func commodity(coin string) string {
+	coin = strings.ToUpper(coin)
+
+	if coin == "" || coin[0] < 'A' || coin[0] > 'Z' {
+		return "X" + coin
+	}
+
+	return coin
+}
+
+// ftxAccount returns an account of the tree of an FTX account,
+// "Assets:FTX:Main:BTC" or "Income:FTX:Sub1:Funding".
+func ftxAccount(root, account string, names ...string) string {
+	parts := []string{root, "FTX", accountName(account)}
+
+	for _, n := range names {
+		parts = append(parts, accountName(n))
+	}
+
+	return strings.Join(parts, ":")
+}
+
+// buildJournal turns the ledger entries into balanced transactions. The two
+// entries of a spot fill, a conversion or a leveraged token creation or
+// redemption become one swap.
+func buildJournal(entries []*ledgerEntry, accounts journalAccounts) []*journalTxn {
+	var txns []*journalTxn
+
+	for i := 0; i < len(entries); i++ {
+		e := entries[i]
+		txn := &journalTxn{time: e.time, reference: e.reference, dataset: e.dataset}
+		asset := func(coin string, amount decimal.Decimal) *posting {
+			return &posting{account: ftxAccount("Assets", e.account, commodity(coin)), amount: amount, commodity: commodity(coin)}
+		}
+		other := func(acc, coin string, amount decimal.Decimal) *posting {
+			return &posting{account: acc, amount: amount, commodity: commodity(coin)}
+		}
+		income := func(name, coin string, amount decimal.Decimal) {
+			txn.postings = append(txn.postings, asset(coin, amount))
+
+			if amount.IsNegative() {
+				txn.postings = append(txn.postings, other(ftxAccount("Expenses", e.account, name), coin, amount.Neg()))
+			} else {
+				txn.postings = append(txn.postings, other(ftxAccount("Income", e.account, name), coin, amount.Neg()))
+			}
+		}
+
+		switch e.kind {
+		case ledgerTrade, ledgerConversion, ledgerCreation, ledgerRedemption:
+			quote := e
+
+			if i+1 < len(entries) && entries[i+1].kind == e.kind && entries[i+1].account == e.account && entries[i+1].reference == e.reference {
+				i++
+				quote = entries[i]
+			}
+
+			base := asset(e.coin, e.amount)
+			base.totalPrice, base.totalCommodity = quote.amount.Abs(), commodity(quote.coin)
+			verb := "Buy"
+
+			if e.amount.IsNegative() {
+				verb = "Sell"
+			}
+
+			switch e.kind {
+			case ledgerConversion:
+				txn.narration = fmt.Sprintf("Convert %s %s to %s %s", quote.amount.Abs(), quote.coin, e.amount, e.coin)
+			case ledgerCreation:
+				txn.narration = fmt.Sprintf("Create %s %s for %s %s", e.amount, e.coin, quote.amount.Abs(), quote.coin)
+			case ledgerRedemption:
+				txn.narration = fmt.Sprintf("Redeem %s %s for %s %s", e.amount.Abs(), e.coin, quote.amount, quote.coin)
+			default:
+				txn.narration = fmt.Sprintf("%s %s %s for %s %s", verb, e.amount.Abs(), e.coin, quote.amount.Abs(), quote.coin)
+			}
+
+			txn.postings = append(txn.postings, base, asset(quote.coin, quote.amount))
+		case ledgerFutures:
+			txn.narration = fmt.Sprintf("%s %s trading fee", e.coin, e.amount)
+		case ledgerDeposit:
+			txn.narration = fmt.Sprintf("Deposit of %s %s", e.amount, e.coin)
+			txn.postings = append(txn.postings, asset(e.coin, e.amount), other(accounts.deposits, e.coin, e.amount.Neg()))
+		case ledgerWithdrawal:
+			txn.narration = fmt.Sprintf("Withdrawal of %s %s", e.amount.Neg(), e.coin)
+			txn.postings = append(txn.postings, asset(e.coin, e.amount), other(accounts.withdrawals, e.coin, e.amount.Neg()))
+		case ledgerFunding:
+			txn.narration = "Funding payment"
+			income("Funding", e.coin, e.amount)
+		case ledgerLending:
+			txn.narration = "Lending proceeds"
+			income("Interest", e.coin, e.amount)
+		case ledgerBorrow:
+			txn.narration = "Borrow cost"
+			income("Interest", e.coin, e.amount)
+		case ledgerRebate:
+			txn.narration = "Referral rebate"
+			income("Rebates", e.coin, e.amount)
+		case ledgerOption:
+			txn.narration = "Options premium"
+			income("Options", e.coin, e.amount)
+		case ledgerStaking:
+			txn.narration = "Staking reward"
+			income("Staking", e.coin, e.amount)
+		case ledgerAirdrop:
+			txn.narration = "Airdrop"
+			income("Airdrops", e.coin, e.amount)
+		}
+
+		// Negative fees are maker rebates.
+		if !e.feeAmount.IsZero() {
+			feeAccount := ftxAccount("Expenses", e.account, "Fees")
+
+			if e.feeAmount.IsNegative() {
+				feeAccount = ftxAccount("Income", e.account, "Rebates")
+			}
+
+			txn.postings = append(txn.postings, other(feeAccount, e.feeCoin, e.feeAmount), asset(e.feeCoin, e.feeAmount.Neg()))
+		}
+
+		if len(txn.postings) > 0 {
+			txns = append(txns, txn)
+		}
+	}
+
+	return txns
+}
+
+// openedAccounts returns every account of the transactions with the date of
+// its first posting.
+func openedAccounts(txns []*journalTxn) []openedAccount {
+	first := map[string]time.Time{}
+
+	for _, txn := range txns {
+		for _, p := range txn.postings {
+			if _, ok := first[p.account]; !ok {
+				first[p.account] = txn.time
+			}
+		}
+	}
+
+	opened := make([]openedAccount, 0, len(first))
+
+	for name, date := range first {
+		opened = append(opened, openedAccount{name: name, date: date})
+	}
+
+	sort.Slice(opened, func(a, b int) bool {
+		if !opened[a].date.Equal(opened[b].date) {
+			return opened[a].date.Before(opened[b].date)
+		}
+
+		return opened[a].name < opened[b].name
+	})
+
+	return opened
+}
+
+func writeBeancount(w io.Writer, opened []openedAccount, txns []*journalTxn) {
+	fmt.Fprintf(w, "option \"title\" \"FTX\"\noption \"operating_currency\" \"USD\"\n\n")
+
+	for _, a := range opened {
+		fmt.Fprintf(w, "%s open %s\n", a.date.UTC().Format("2006-01-02"), a.name)
+	}
+
+	for _, txn := range txns {
+		fmt.Fprintf(w, "\n%s * \"FTX\" %q\n", txn.time.UTC().Format("2006-01-02"), txn.narration)
+		fmt.Fprintf(w, "  time: %q\n", txn.time.UTC().Format(time.RFC3339Nano))
+		fmt.Fprintf(w, "  dataset: %q\n", txn.dataset)
+
+		if txn.reference != "" {
+			fmt.Fprintf(w, "  ftx-id: %q\n", txn.reference)
+		}
+
+		for _, p := range txn.postings {
+			fmt.Fprintf(w, "  %-44s %s %s", p.account, p.amount, p.commodity)
+
+			if p.totalCommodity != "" {
+				fmt.Fprintf(w, " @@ %s %s", p.totalPrice, p.totalCommodity)
+			}
+
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+// ledgerCommodity quotes commodities that are not only letters, as Ledger and
+// hledger require.
+func ledgerCommodity(c string) string {
+	for _, r := range c {
+		if r < 'A' || r > 'Z' {
+			return fmt.Sprintf("%q", c)
+		}
+	}
+
+	return c
+}
+
+func writeLedgerJournal(w io.Writer, opened []openedAccount, txns []*journalTxn) {
+	for _, a := range opened {
+		fmt.Fprintf(w, "account %s\n", a.name)
+	}
+
+	for _, txn := range txns {
+		fmt.Fprintf(w, "\n%s * %s\n", txn.time.UTC().Format("2006-01-02"), txn.narration)
+		fmt.Fprintf(w, "    ; time: %s\n", txn.time.UTC().Format(time.RFC3339Nano))
+		fmt.Fprintf(w, "    ; dataset: %s\n", txn.dataset)
+
+		if txn.reference != "" {
+			fmt.Fprintf(w, "    ; ftx-id: %s\n", txn.reference)
+		}
+
+		for _, p := range txn.postings {
+			fmt.Fprintf(w, "    %-44s  %s %s", p.account, p.amount, ledgerCommodity(p.commodity))
+
+			if p.totalCommodity != "" {
+				fmt.Fprintf(w, " @@ %s %s", p.totalPrice, ledgerCommodity(p.totalCommodity))
+			}
+
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+// writeJournals writes the history of all accounts as one journal per
+// format, "ftx.beancount" and "ftx.journal". Every account has its own tree
+// of accounts. It returns the manifest items of the written files.
+func writeJournals(dir string, accounts []string, formats []*journalFormat, journal journalAccounts) ([]*manifestItem, error) {
+	var items []*manifestItem
+	var all []*ledgerEntry
+
+	for _, account := range accounts {
+		entries, err := loadLedger(dir, account)
+
+		if err != nil {
+			return items, fmt.Errorf("journal of %s: %w", account, err)
+		}
+
+		all = append(all, entries...)
+	}
+
+	sortLedger(all)
+	txns := buildJournal(all, journal)
+	opened := openedAccounts(txns)
+
+	for _, f := range formats {
+		path := filepath.Join(dir, "ftx"+f.ext)
+		file, err := os.Create(path)
+
+		if err != nil {
+			return items, err
+		}
+
+		w := bufio.NewWriter(file)
+		f.write(w, opened, txns)
+
+		if err := w.Flush(); err != nil {
+			file.Close()
+			return items, err
+		}
+
+		if err := file.Close(); err != nil {
+			return items, err
+		}
+
+		golog.Infof("Wrote %d %s transactions to %s", len(txns), f.name, path)
+
+		item := &manifestItem{Path: filepath.Base(path), Dataset: f.name}
+
+		if err := describeFile(path, "", item); err != nil {
+			return items, err
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func entry(minutes int, kind ledgerKind, coin, amount, reference string) *ledgerEntry {
+	return &ledgerEntry{time: at(minutes), account: "main", kind: kind, coin: coin, amount: dec(amount), reference: reference, dataset: string(kind)}
+}
+
+func withFee(e *ledgerEntry, coin, amount string) *ledgerEntry {
+	e.feeCoin, e.feeAmount = coin, dec(amount)
+	return e
+}
+
+// journalWeights parses the transactions of a written journal and returns
+// the weight of every transaction per commodity. A posting with a total price
+// weighs the price in its commodity.
+func journalWeights(t *testing.T, journal string) []map[string]decimal.Decimal {
+	t.Helper()
+
+	var txns []map[string]decimal.Decimal
+
+	for _, block := range strings.Split(journal, "\n\n") {
+		lines := strings.Split(strings.TrimSpace(block), "\n")
+
+		// Options and account declarations.
+		if fields := strings.Fields(lines[0]); len(fields) < 2 || fields[1] != "*" {
+			continue
+		}
+
+		weights := map[string]decimal.Decimal{}
+
+		for _, line := range lines[1:] {
+			fields := strings.Fields(line)
+
+			// Metadata and comments.
+			if len(fields) == 0 || fields[0][0] < 'A' || fields[0][0] > 'Z' {
+				continue
+			}
+
+			if len(fields) != 3 && len(fields) != 6 {
+				t.Fatalf("posting %q has %d fields", line, len(fields))
+			}
+
+			amount := dec(fields[1])
+			coin := strings.Trim(fields[2], `"`)
+
+			if len(fields) == 6 {
+				if fields[3] != "@@" {
+					t.Fatalf("posting %q has no total price", line)
+				}
+
+				price := dec(fields[4])
+
+				if amount.IsNegative() {
+					price = price.Neg()
+				}
+
+				amount, coin = price, strings.Trim(fields[5], `"`)
+			}
+
+			weights[coin] = weights[coin].Add(amount)
+		}
+
+		txns = append(txns, weights)
+	}
+
+	return txns
+}
+
+func TestJournalBalances(t *testing.T) {
+	accounts := journalAccounts{deposits: "Equity:Deposits", withdrawals: "Equity:Withdrawals"}
+
+	tests := []struct {
+		name    string
+		entries []*ledgerEntry
+		// Number of transactions.
+		want int
+	}{
+		{
+			name: "spot fill",
+			entries: []*ledgerEntry{
+				withFee(entry(0, ledgerTrade, "BTC", "0.5", "1"), "USD", "2.5"),
+				entry(0, ledgerTrade, "USD", "-10000", "1"),
+			},
+			want: 1,
+		},
+		{
+			name: "sell with maker rebate",
+			entries: []*ledgerEntry{
+				withFee(entry(0, ledgerTrade, "1INCH", "-100", "2"), "USD", "-0.01"),
+				entry(0, ledgerTrade, "USD", "150", "2"),
+			},
+			want: 1,
+		},
+		{
+			name: "conversion and leveraged tokens",
+			entries: []*ledgerEntry{
+				entry(0, ledgerConversion, "ETH", "2", "3"),
+				entry(0, ledgerConversion, "BTC", "-0.15", "3"),
+				withFee(entry(1, ledgerCreation, "BULL", "1", "4"), "USD", "0.5"),
+				entry(1, ledgerCreation, "USD", "-500", "4"),
+				entry(2, ledgerRedemption, "BULL", "-1", "5"),
+				entry(2, ledgerRedemption, "USD", "490", "5"),
+			},
+			want: 3,
+		},
+		{
+			name: "fee-only futures fill",
+			entries: []*ledgerEntry{
+				withFee(entry(0, ledgerFutures, "BTC-PERP", "0.1", "6"), "USD", "1.2"),
+				// Without a fee a futures fill moves no coin.
+				entry(1, ledgerFutures, "BTC-PERP", "-0.1", "7"),
+			},
+			want: 1,
+		},
+		{
+			name: "single legs",
+			entries: []*ledgerEntry{
+				entry(0, ledgerFunding, "USD", "-0.3", "8"),
+				entry(1, ledgerFunding, "USD", "0.2", "9"),
+				entry(2, ledgerBorrow, "BTC", "-0.0001", ""),
+				entry(3, ledgerLending, "USD", "1.5", ""),
+				entry(4, ledgerRebate, "USD", "0.7", ""),
+				entry(5, ledgerOption, "USD", "-25", "10"),
+				entry(6, ledgerStaking, "SRM", "3", "11"),
+				entry(7, ledgerAirdrop, "MAPS", "10", "12"),
+			},
+			want: 8,
+		},
+		{
+			name: "deposit and withdrawal with fees",
+			entries: []*ledgerEntry{
+				withFee(entry(0, ledgerDeposit, "USDT", "100", "13"), "USDT", "1"),
+				withFee(entry(1, ledgerWithdrawal, "USDT", "-50", "14"), "USDT", "0.5"),
+			},
+			want: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		txns := buildJournal(tt.entries, accounts)
+		opened := openedAccounts(txns)
+
+		for _, f := range journalFormats {
+			t.Run(tt.name+" "+f.name, func(t *testing.T) {
+				var b bytes.Buffer
+				f.write(&b, opened, txns)
+
+				got := journalWeights(t, b.String())
+
+				if len(got) != tt.want {
+					t.Fatalf("%d transactions, want %d:\n%s", len(got), tt.want, b.String())
+				}
+
+				for i, weights := range got {
+					for coin, sum := range weights {
+						if !sum.IsZero() {
+							t.Errorf("transaction %d: %s sums to %s:\n%s", i, coin, sum, b.String())
+						}
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/kataras/golog"
+	"github.com/shopspring/decimal"
+)
+
+// ledgerKind is the type of a ledger entry.
+type ledgerKind string
+
+const (
+	ledgerTrade      ledgerKind = "trade"
+	ledgerFutures    ledgerKind = "futures_trade"
+	ledgerDeposit    ledgerKind = "deposit"
+	ledgerWithdrawal ledgerKind = "withdrawal"
+	ledgerFunding    ledgerKind = "funding"
+	ledgerBorrow     ledgerKind = "borrow_cost"
+	ledgerLending    ledgerKind = "lending_proceeds"
+	ledgerRebate     ledgerKind = "referral_rebate"
+	ledgerStaking    ledgerKind = "staking_reward"
+	ledgerAirdrop    ledgerKind = "airdrop"
+	ledgerConversion ledgerKind = "conversion"
+	ledgerCreation   ledgerKind = "lt_creation"
+	ledgerRedemption ledgerKind = "lt_redemption"
+	ledgerOption     ledgerKind = "option_trade"
+)
+
+// ledgerEntry is one movement of a coin in the common schema of all datasets.
+// The amount is signed and does not include the fee, a negative fee is a
+// rebate.
+type ledgerEntry struct {
+	time      time.Time
+	account   string
+	kind      ledgerKind
+	coin      string
+	amount    decimal.Decimal
+	feeCoin   string
+	feeAmount decimal.Decimal
+	reference string
+	dataset   string
+}
+
+// balanceDelta is the change of the balance of coin by the entry. Futures
+// trades change a position and not a balance.
+func (e *ledgerEntry) balanceDelta() decimal.Decimal {
+	if e.kind == ledgerFutures {
+		return decimal.Zero
+	}
+
+	return e.amount
+}
+
+// rank orders entries of the same second, deposits first and withdrawals
+// last.
+func (e *ledgerEntry) rank() int {
+	switch e.kind {
+	case ledgerDeposit:
+		return 0
+	case ledgerWithdrawal:
+		return 2
+	}
+
+	return 1
+}
+
+var ledgerHeader = []string{"Time", "Subaccount", "Type", "Coin", "Amount", "FeeCoin", "FeeAmount", "ReferenceID", "Dataset"}
+
+// loadLedger reads the exported history of an account into ledger entries in
+// time order. Spot fills, conversions and leveraged token creations and
+// redemptions are two entries, one per coin, the fee is part of the base
+// entry. Options fills are their USD premium. Deposits, withdrawals, rewards
+// and airdrops that were not completed, quotes that were not filled and
+// pending creations and redemptions are left out.
+func loadLedger(dir, account string) ([]*ledgerEntry, error) {
+	var entries []*ledgerEntry
+
+	add := func(t time.Time, kind ledgerKind, coin string, amount decimal.Decimal, reference, dataset string) *ledgerEntry {
+		e := &ledgerEntry{time: t, account: account, kind: kind, coin: coin, amount: amount, reference: reference, dataset: dataset}
+		entries = append(entries, e)
+		return e
+	}
+
+	id := func(r record) string {
+		return strconv.FormatInt(r.int("id"), 10)
+	}
+
+	fills, err := loadRecords(dir, account, "transaction_history")
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range fills {
+		t := f.time("time")
+		size := f.dec("size")
+
+		if f.str("side") == "sell" {
+			size = size.Neg()
+		}
+
+		var e *ledgerEntry
+
+		if future := f.str("future"); future != "" {
+			e = add(t, ledgerFutures, future, size, id(f), "transaction_history")
+		} else {
+			e = add(t, ledgerTrade, f.str("base_currency"), size, id(f), "transaction_history")
+			add(t, ledgerTrade, f.str("quote_currency"), size.Mul(f.dec("price")).Neg(), id(f), "transaction_history")
+		}
+
+		if !f.dec("fee").IsZero() {
+			e.feeCoin, e.feeAmount = f.str("fee_currency"), f.dec("fee")
+		}
+	}
+
+	deposits, err := loadRecords(dir, account, "deposit_history")
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range deposits {
+		if !transferDone(d.str("status")) {
+			continue
+		}
+
+		e := add(d.time("time"), ledgerDeposit, d.str("coin"), d.dec("size"), id(d), "deposit_history")
+
+		if !d.dec("fee").IsZero() {
+			e.feeCoin, e.feeAmount = d.str("coin"), d.dec("fee")
+		}
+	}
+
+	withdrawals, err := loadRecords(dir, account, "withdrawal_history")
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, w := range withdrawals {
+		if !transferDone(w.str("status")) {
+			continue
+		}
+
+		e := add(w.time("time"), ledgerWithdrawal, w.str("coin"), w.dec("size").Neg(), id(w), "withdrawal_history")
+
+		if !w.dec("fee").IsZero() {
+			e.feeCoin, e.feeAmount = w.str("coin"), w.dec("fee")
+		}
+	}
+
+	funding, err := loadRecords(dir, account, "futures_funding")
+
+	if err != nil {
+		return nil, err
+	}
+
+	// A positive payment was paid by the account.
+	for _, f := range funding {
+		add(f.time("time"), ledgerFunding, "USD", f.dec("payment").Neg(), id(f), "futures_funding")
+	}
+
+	borrows, err := loadRecords(dir, account, "borrow_history")
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, b := range borrows {
+		add(b.time("time"), ledgerBorrow, b.str("coin"), b.dec("cost").Neg(), "", "borrow_history")
+	}
+
+	lending, err := loadRecords(dir, account, "lending_history")
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, l := range lending {
+		add(l.time("time"), ledgerLending, l.str("coin"), l.dec("proceeds"), "", "lending_history")
+	}
+
+	rebates, err := loadRecords(dir, account, "referral_rebates")
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range rebates {
+		add(r.time("day"), ledgerRebate, "USD", r.dec("size"), "", "referral_rebates")
+	}
+
+	rewards, err := loadRecords(dir, account, "staking_rewards")
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range rewards {
+		if transferDone(r.str("status")) {
+			add(r.time("time"), ledgerStaking, r.str("coin"), r.dec("size"), id(r), "staking_rewards")
+		}
+	}
+
+	airdrops, err := loadRecords(dir, account, "airdrops")
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, a := range airdrops {
+		if transferDone(a.str("status")) {
+			add(a.time("time"), ledgerAirdrop, a.str("coin"), a.dec("size"), id(a), "airdrops")
+		}
+	}
+
+	conversions, err := loadRecords(dir, account, "conversions")
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range conversions {
+		if !c.bool("filled") {
+			continue
+		}
+
+		add(c.time("time"), ledgerConversion, c.str("to_coin"), c.dec("proceeds"), id(c), "conversions")
+		add(c.time("time"), ledgerConversion, c.str("from_coin"), c.dec("cost").Neg(), id(c), "conversions")
+	}
+
+	creations, err := loadRecords(dir, account, "lt_creations")
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range creations {
+		if c.bool("pending") {
+			continue
+		}
+
+		e := add(c.time("fulfilled_at"), ledgerCreation, c.str("token"), c.dec("created_size"), id(c), "lt_creations")
+		add(c.time("fulfilled_at"), ledgerCreation, "USD", c.dec("cost").Neg(), id(c), "lt_creations")
+
+		if !c.dec("fee").IsZero() {
+			e.feeCoin, e.feeAmount = "USD", c.dec("fee")
+		}
+	}
+
+	redemptions, err := loadRecords(dir, account, "lt_redemptions")
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The proceeds are paid after the fee.
+	for _, r := range redemptions {
+		if r.bool("pending") {
+			continue
+		}
+
+		e := add(r.time("fulfilled_at"), ledgerRedemption, r.str("token"), r.dec("size").Neg(), id(r), "lt_redemptions")
+		add(r.time("fulfilled_at"), ledgerRedemption, "USD", r.dec("proceeds").Add(r.dec("fee")), id(r), "lt_redemptions")
+
+		if !r.dec("fee").IsZero() {
+			e.feeCoin, e.feeAmount = "USD", r.dec("fee")
+		}
+	}
+
+	options, err := loadRecords(dir, account, "options_fills")
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, o := range options {
+		premium := o.dec("size").Mul(o.dec("price"))
+
+		if o.str("side") == "buy" {
+			premium = premium.Neg()
+		}
+
+		e := add(o.time("time"), ledgerOption, "USD", premium, id(o), "options_fills")
+
+		if !o.dec("fee").IsZero() {
+			e.feeCoin, e.feeAmount = "USD", o.dec("fee")
+		}
+	}
+
+	sortLedger(entries)
+	return entries, nil
+}
+
+func sortLedger(entries []*ledgerEntry) {
+	sort.SliceStable(entries, func(a, b int) bool {
+		if !entries[a].time.Equal(entries[b].time) {
+			return entries[a].time.Before(entries[b].time)
+		}
+
+		return entries[a].rank() < entries[b].rank()
+	})
+}
+
+func writeLedger(path string, entries []*ledgerEntry) error {
+	file, err := os.Create(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	csvWriter := outFormat.csvWriter(file)
+	csvWriter.Write(ledgerHeader)
+
+	for _, e := range entries {
+		feeAmount := ""
+
+		if e.feeCoin != "" {
+			feeAmount = outFormat.decimal(e.feeAmount)
+		}
+
+		csvWriter.Write([]string{
+			outFormat.time(e.time),
+			subAccountOf(e.account),
+			string(e.kind),
+			e.coin,
+			outFormat.decimal(e.amount),
+			e.feeCoin,
+			feeAmount,
+			e.reference,
+			e.dataset,
+		})
+	}
+
+	csvWriter.Flush()
+
+	if err := csvWriter.Error(); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+// writeLedgers writes the ledger of every account, "Main_ledger.csv", and
+// with combined one ledger of all accounts, "ledger.csv". It returns the
+// manifest items of the written files.
+func writeLedgers(dir string, accounts []string, perAccount, combined bool) ([]*manifestItem, error) {
+	var items []*manifestItem
+	var all []*ledgerEntry
+
+	for _, account := range accounts {
+		entries, err := loadLedger(dir, account)
+
+		if err != nil {
+			return items, fmt.Errorf("ledger of %s: %w", account, err)
+		}
+
+		all = append(all, entries...)
+
+		if !perAccount {
+			continue
+		}
+
+		path := filepath.Join(dir, account+"_ledger.csv")
+
+		if err := writeLedger(path, entries); err != nil {
+			return items, err
+		}
+
+		golog.Infof("Wrote %d ledger entries for %s", len(entries), account)
+
+		item := &manifestItem{Path: filepath.Base(path), Subaccount: subAccountOf(account), Dataset: "ledger"}
+
+		if err := describeFile(path, "Time", item); err != nil {
+			return items, err
+		}
+
+		items = append(items, item)
+	}
+
+	if !combined {
+		return items, nil
+	}
+
+	sortLedger(all)
+	path := filepath.Join(dir, "ledger.csv")
+
+	if err := writeLedger(path, all); err != nil {
+		return items, err
+	}
+
+	golog.Infof("Wrote %d ledger entries of all accounts", len(all))
+
+	item := &manifestItem{Path: filepath.Base(path), Dataset: "ledger"}
+
+	if err := describeFile(path, "Time", item); err != nil {
+		return items, err
+	}
+
+	return append(items, item), nil
+}
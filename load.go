@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// record is a row of an exported CSV file read back, keyed by field name.
+type record map[string]interface{}
+
+func (r record) str(field string) string {
+	s, _ := r[field].(string)
+	return s
+}
+
+func (r record) int(field string) int64 {
+	n, _ := r[field].(int64)
+	return n
+}
+
+func (r record) dec(field string) decimal.Decimal {
+	d, _ := r[field].(decimal.Decimal)
+	return d
+}
+
+func (r record) time(field string) time.Time {
+	t, _ := r[field].(time.Time)
+	return t
+}
+
+func (r record) bool(field string) bool {
+	b, _ := r[field].(bool)
+	return b
+}
+
+// exportPath returns the output file of a dataset of an account.
+func exportPath(dir, account string, f fetcher) string {
+	return filepath.Join(dir, fmt.Sprintf("%s_%s%s", account, f.dataset, f.ext))
+}
+
+// fetcherOf returns the fetcher of a dataset.
+func fetcherOf(dataset string) fetcher {
+	for _, f := range fetchers {
+		if f.dataset == dataset {
+			return f
+		}
+	}
+
+	panic("unknown dataset " + dataset)
+}
+
+// loadRecords reads the CSV file of a dataset of an account in the output
+// directory, newest record first. A missing file has no records.
+func loadRecords(dir, account, dataset string) ([]record, error) {
+	f := fetcherOf(dataset)
+	path := exportPath(dir, account, f)
+	file, err := os.Open(path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	recs, err := readRecords(file, f.ds.table())
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+
+	return recs, nil
+}
+
+func readRecords(r io.Reader, t *table) ([]record, error) {
+	reader := outFormat.csvReader(r)
+	header, err := reader.Read()
+
+	if err == io.EOF {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	kinds := map[string]column{}
+
+	for _, c := range t.columns {
+		kinds[c.name] = c
+	}
+
+	var recs []record
+
+	for {
+		row, err := reader.Read()
+
+		if err == io.EOF {
+			return recs, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		rec := record{}
+
+		for i, name := range header {
+			c, ok := kinds[name]
+
+			if !ok || i >= len(row) {
+				continue
+			}
+
+			v, err := parseValue(c.kind, row[i])
+
+			if err != nil {
+				line, _ := reader.FieldPos(i)
+				return nil, fmt.Errorf("line %d, %s: %w", line, name, err)
+			}
+
+			rec[c.fieldName()] = v
+		}
+
+		recs = append(recs, rec)
+	}
+}
+
+// parseValue is the inverse of formatValue.
+func parseValue(kind columnKind, s string) (interface{}, error) {
+	switch kind {
+	case kindInt:
+		if s == "" {
+			return int64(0), nil
+		}
+
+		return strconv.ParseInt(s, 10, 64)
+	case kindDecimal:
+		if s == "" {
+			return decimal.Zero, nil
+		}
+
+		return outFormat.parseDecimal(s)
+	case kindTime:
+		return parseRecordTime(s)
+	case kindBool:
+		return strconv.ParseBool(s)
+	}
+
+	return s, nil
+}
@@ -1,557 +1,539 @@
 package main
 
 import (
+	"context"
 	"encoding/csv"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/beefsack/go-rate"
 	"github.com/grishinsana/goftx"
-	"github.com/grishinsana/goftx/models"
 	"github.com/kataras/golog"
-	"github.com/ncruces/zenity"
 )
 
+// limiter is shared by all workers so the whole export stays below the API
+// rate limit.
 var limiter *rate.RateLimiter = rate.New(28, time.Second)
 
 func main() {
-	done := make(chan struct{})
+	os.Exit(runCLI(os.Args[1:]))
+}
 
-	key, err := zenity.Entry("API Key", zenity.Title("Paste your API key"))
-	if err != nil {
-		os.Exit(1)
-	}
+type fetcher struct {
+	label   string
+	dataset string
+	ext     string
+	// CSV column with the record timestamps, used for the manifest.
+	timeColumn string
+	ds         dataset
+}
 
-	secret, err := zenity.Entry("API Secret", zenity.Title("Paste your API secret"))
-	if err != nil {
-		os.Exit(1)
+// fetchers lists the datasets in the order they are reported for every account.
+var fetchers = []fetcher{
+	{"transactions", "transaction_history", ".csv", "Time", fillsDataset},
+	{"withdrawals", "withdrawal_history", ".csv", "Time", withdrawalsDataset},
+	{"deposits", "deposit_history", ".csv", "Time", depositsDataset},
+	{"referral rebates", "referral_rebates", ".csv", "Day", rebatesDataset},
+	{"funding records", "futures_funding", ".csv", "Time", fundingDataset},
+	{"borrow history", "borrow_history", ".csv", "Time", borrowDataset},
+	{"lending history", "lending_history", ".csv", "Time", lendingDataset},
+	{"staking rewards", "staking_rewards", ".csv", "Time", stakingRewardsDataset},
+	{"airdrops", "airdrops", ".csv", "Time", airdropsDataset},
+	{"conversions", "conversions", ".csv", "Time", conversionsDataset},
+	{"leveraged token creations", "lt_creations", ".csv", "RequestedAt", tokenCreationsDataset},
+	{"leveraged token redemptions", "lt_redemptions", ".csv", "RequestedAt", tokenRedemptionsDataset},
+	{"options fills", "options_fills", ".csv", "Time", optionFillsDataset},
+	{"orders", "order_history", ".csv", "CreatedAt", ordersDataset},
+	{"trigger orders", "trigger_order_history", ".csv", "CreatedAt", triggerOrdersDataset},
+	{"account values", "account_value_history", ".csv", "Time", accountValueDataset},
+	{"balances", "balances", ".csv", "Time", balancesDataset},
+	{"positions", "positions", ".csv", "Time", positionsDataset},
+	{"options positions", "options_positions", ".csv", "Time", optionPositionsDataset},
+	{"account details", "account_details", ".json", "", accountDetails{}},
+}
+
+// exportJob is the download of one dataset of one account.
+type exportJob struct {
+	fetcher
+	ctx        context.Context
+	client     *goftx.Client
+	state      *exportState
+	subAccount string
+	account    string
+	outFile    string
+	full       bool
+	// Set by openCSV when the output file was started over.
+	restarted bool
+	// Outputs that receive the records next to the CSV files.
+	sinks []sink
+	// Time range requested from the API, nil when the dataset has no windows.
+	requested *timeRange
+	filter    *exportFilter
+}
+
+// openCSV opens the output file for appending. The file and the checkpoints of
+// the dataset are started over when the file is empty or a full download was
+// requested. Files of checkpointed datasets are also started over when the
+// state has no checkpoint for them, after the state was lost or for files of
+// another tool, so the history is not appended a second time.
+func (j *exportJob) openCSV(header []string, checkpointed bool) (*os.File, *csv.Writer, error) {
+	restart := j.full
+
+	if checkpointed && j.state != nil {
+		ds := j.state.dataset(j.account, j.dataset)
+		restart = restart || (ds.Done == nil && ds.Pending == nil)
 	}
 
-	golog.Info("Starting download of account data")
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
 
-	client := goftx.New(goftx.WithAuth(key, secret))
+	if restart {
+		flags |= os.O_TRUNC
+	}
 
-	accList, err := client.GetSubaccounts()
+	file, err := os.OpenFile(j.outFile, flags, 0666)
 
 	if err != nil {
-		golog.Error(err)
+		return nil, nil, err
 	}
 
-	run := func(subAcc string) {
-		label := subAcc
-		if subAcc == "" {
-			label = "Main"
-		}
-
-		var subClient *goftx.Client
+	info, err := file.Stat()
 
-		if subAcc == "" {
-			subClient = goftx.New(goftx.WithAuth(key, secret))
-		} else {
-			subClient = goftx.New(goftx.WithAuth(key, secret), goftx.WithSubaccount(subAcc))
-		}
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
 
-		count, err := fetchTransactions(subClient, fmt.Sprintf("%s_transaction_history.csv", label))
+	csvWriter := outFormat.csvWriter(file)
 
-		golog.Infof("Downloaded %d transactions for %s", count, label)
+	if info.Size() == 0 {
+		j.restarted = true
 
-		if err != nil {
-			golog.Error(err)
+		if j.state != nil {
+			j.state.reset(j.account, j.dataset)
 		}
 
-		count, err = fetchWithdrawals(subClient, fmt.Sprintf("%s_withdrawal_history.csv", label))
-
-		golog.Infof("Downloaded %d withdrawals for %s", count, label)
-
-		if err != nil {
-			golog.Error(err)
+		if err := csvWriter.Write(header); err != nil {
+			file.Close()
+			return nil, nil, err
 		}
+	}
 
-		count, err = fetchDeposits(subClient, fmt.Sprintf("%s_deposit_history.csv", label))
-
-		golog.Infof("Downloaded %d deposits for %s", count, label)
-
-		if err != nil {
-			golog.Error(err)
-		}
+	return file, csvWriter, nil
+}
 
-		count, err = fetchRefRebates(subClient, fmt.Sprintf("%s_referral_rebates.csv", label))
+func export(opts *exportOptions) error {
+	golog.Info("Starting download of account data")
+	started := time.Now()
 
-		golog.Infof("Downloaded %d referral rebates for %s", count, label)
+	if err := os.MkdirAll(opts.outDir, 0777); err != nil {
+		return err
+	}
 
-		if err != nil {
-			golog.Error(err)
-		}
+	if err := setTextFormat(opts.outDir, opts.format, opts.full); err != nil {
+		return err
+	}
 
-		count, err = fetchFunding(subClient, fmt.Sprintf("%s_futures_funding.csv", label))
+	state, err := loadState(filepath.Join(opts.outDir, stateFile))
 
-		golog.Infof("Downloaded %d funding records for %s", count, label)
+	if err != nil {
+		return err
+	}
 
-		if err != nil {
-			golog.Error(err)
-		}
+	if err := setFilter(opts.outDir, state, opts.filter, opts.full); err != nil {
+		return err
+	}
 
-		count, err = fetchBorrowHistory(subClient, fmt.Sprintf("%s_borrow_history.csv", label))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-		golog.Infof("Downloaded %d borrow history for %s", count, label)
+	client := newClient(opts, "")
 
-		if err != nil {
-			golog.Error(err)
-		}
+	failed := 0
+	subAccounts := []string{""}
+	accList, err := call(ctx, client.GetSubaccounts)
 
-		count, err = fetchLendingHistory(subClient, fmt.Sprintf("%s_lending_history.csv", label))
+	var authErr *authError
 
-		golog.Infof("Downloaded %d lending history for %s", count, label)
+	if errors.As(err, &authErr) {
+		return err
+	}
 
-		if err != nil {
-			golog.Error(err)
-		}
+	var runErrs []string
 
-		fetchAccountDetails(subClient, fmt.Sprintf("%s_account_details.json", label))
+	if err != nil {
+		golog.Error(err)
+		runErrs = append(runErrs, err.Error())
+		failed++
 	}
 
-	run("")
-
 	for _, sa := range accList {
-		run(sa.Nickname)
+		subAccounts = append(subAccounts, sa.Nickname)
 	}
 
-	fmt.Println("FINISHED!")
-	fmt.Println("Press CTRL+C to close this window")
-	<-done
-}
-
-func fetchAccountDetails(client *goftx.Client, outFile string) error {
-	acc, err := client.GetAccountInformation()
-
-	if err != nil {
-		return err
-	}
+	sinks, err := openSinks(opts)
 
-	data, err := json.MarshalIndent(acc, "", " ")
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(outFile, data, 0777)
-}
+	jobs := make([]*exportJob, 0, len(subAccounts)*len(fetchers))
+	labels := make([]string, 0, len(subAccounts))
 
-func fetchFunding(client *goftx.Client, outFile string) (int64, error) {
-	since := time.Unix(0, 0)
+	for _, subAcc := range subAccounts {
+		label := accountLabel(subAcc)
 
-	file, err := os.Create(outFile)
+		if !opts.filter.account(label) {
+			golog.Infof("Skipping %s, it is excluded by the filter", label)
+			continue
+		}
 
-	if err != nil {
-		return 0, err
+		labels = append(labels, label)
+		subClient := newClient(opts, subAcc)
+
+		for _, f := range fetchers {
+			jobs = append(jobs, &exportJob{
+				fetcher:    f,
+				ctx:        ctx,
+				client:     subClient,
+				state:      state,
+				subAccount: subAcc,
+				account:    label,
+				outFile:    exportPath(opts.outDir, label, f),
+				full:       opts.full,
+				sinks:      sinks,
+				filter:     opts.filter,
+			})
+		}
 	}
 
-	defer file.Close()
-	csvWriter := csv.NewWriter(file)
-	csvWriter.Write([]string{
-		"Future",
-		"ID",
-		"Payment",
-		"Time",
-	})
+	counts := make([]int64, len(jobs))
+	errs := make([]error, len(jobs))
+	var abortErr error
 
-	start := since.Unix()
-	end := time.Now().Unix()
-	var count int64 = 0
+	runPool(len(jobs), opts.concurrency, func(i int) {
+		counts[i], errs[i] = jobs[i].ds.export(jobs[i])
 
-	for {
-		limiter.Wait()
-		recs, err := client.GetFundingPayments(start, end)
-		if err != nil {
-			return 0, err
-		}
+		var jobAuthErr *authError
 
-		if len(recs) == 0 {
-			break
+		if errors.As(errs[i], &jobAuthErr) {
+			cancel()
 		}
+	}, func(i int) {
+		switch {
+		case errors.As(errs[i], &authErr):
+			if abortErr == nil {
+				abortErr = errs[i]
+			}
+		case errors.Is(errs[i], context.Canceled):
+			// Skipped after the export was aborted.
+		default:
+			golog.Infof("Downloaded %d %s for %s", counts[i], jobs[i].label, jobs[i].account)
+
+			if errs[i] != nil {
+				golog.Errorf("%s for %s: %v", jobs[i].label, jobs[i].account, errs[i])
+				failed++
+			}
+		}
+	})
+
+	if abortErr != nil {
+		runErrs = append(runErrs, abortErr.Error())
+	}
+
+	if err := closeSinks(sinks); err != nil {
+		golog.Error(err)
+		runErrs = append(runErrs, err.Error())
+		failed++
+	}
 
-		start = recs[0].Time.Unix()
-		end = recs[len(recs)-1].Time.Unix()
+	var derivedItems []*manifestItem
 
-		for i := range recs {
-			count++
-			f := recs[i]
+	if abortErr == nil {
+		derivedItems, err = writeDerived(opts, labels)
 
-			csvWriter.Write([]string{
-				f.Future,
-				fmt.Sprintf("%d", f.ID),
-				f.Payment.String(),
-				f.Time.String(),
-			})
+		if err != nil {
+			golog.Error(err)
+			runErrs = append(runErrs, err.Error())
+			failed++
 		}
 	}
 
-	csvWriter.Flush()
-	return count, nil
-}
-
-func fetchBorrowHistory(client *goftx.Client, outFile string) (int64, error) {
-	since := time.Unix(0, 0)
+	m := buildManifest(started, jobs, errs, runErrs)
+	m.Files = append(m.Files, derivedItems...)
+	m.Filter = opts.filter
 
-	file, err := os.Create(outFile)
+	if err := writeManifest(opts.outDir, m); err != nil {
+		return err
+	}
 
-	if err != nil {
-		return 0, err
+	if abortErr != nil {
+		return abortErr
 	}
 
-	defer file.Close()
-	csvWriter := csv.NewWriter(file)
-	csvWriter.Write([]string{
-		"Coin",
-		"Cost",
-		"Rate",
-		"Size",
-		"Time",
-	})
+	if failed > 0 {
+		return fmt.Errorf("%d downloads failed", failed)
+	}
 
-	start := since.Unix()
-	end := time.Now().Unix()
-	var count int64 = 0
+	return nil
+}
 
-	for {
-		limiter.Wait()
-		recs, err := client.SpotMargin.GetBorrowHistory(start, end)
+// setFilter records the filter of an export in the state. The checkpoints only
+// cover the records of the filter, so changing it needs a full download.
+func setFilter(dir string, state *exportState, filter *exportFilter, full bool) error {
+	if !full && !filter.equal(state.Filter) {
+		existing, err := filepath.Glob(filepath.Join(dir, "*.csv"))
 
 		if err != nil {
-			return 0, err
+			return err
 		}
 
-		if len(recs) == 0 {
-			break
+		if len(existing) > 0 {
+			return fmt.Errorf("the files in %s were exported with %s, run with -full to change the filter", dir, state.Filter)
 		}
+	}
 
-		start = recs[0].Time.Unix()
-		end = recs[len(recs)-1].Time.Unix()
-
-		for i := range recs {
-			count++
-			f := recs[i]
-
-			csvWriter.Write([]string{
-				f.Coin,
-				f.Cost.String(),
-				f.Rate.String(),
-				f.Size.String(),
-				f.Time.String(),
-			})
-		}
+	if filter != nil {
+		golog.Infof("Exporting %s", filter)
 	}
 
-	csvWriter.Flush()
-	return count, nil
+	state.Filter = filter
+	return nil
 }
 
-func fetchLendingHistory(client *goftx.Client, outFile string) (int64, error) {
-	since := time.Unix(0, 0)
+// writeDerived writes the files that are built from the CSV files of all
+// accounts after the downloads, the monthly rebate totals, the workbook, the
+// tax tool imports, the ledgers and the journals.
+func writeDerived(opts *exportOptions, labels []string) ([]*manifestItem, error) {
+	var items []*manifestItem
 
-	file, err := os.Create(outFile)
+	if err := checkOrderLinks(opts.outDir, labels); err != nil {
+		return items, err
+	}
+
+	rebateItems, err := writeRebateTotals(opts.outDir, labels)
+	items = append(items, rebateItems...)
 
 	if err != nil {
-		return 0, err
+		return items, err
 	}
 
-	defer file.Close()
-	csvWriter := csv.NewWriter(file)
-	csvWriter.Write([]string{
-		"Coin",
-		"Proceeds",
-		"Rate",
-		"Size",
-		"Time",
-	})
+	if opts.xlsx {
+		workbookItems, err := writeWorkbooks(opts.outDir, labels)
+		items = append(items, workbookItems...)
 
-	start := since.Unix()
-	end := time.Now().Unix()
-	var count int64 = 0
+		if err != nil {
+			return items, err
+		}
+	}
 
-	for {
-		limiter.Wait()
-		recs, err := client.SpotMargin.GetLendingHistory(start, end)
+	if len(opts.profiles) > 0 {
+		profileItems, err := writeProfiles(opts.outDir, labels, opts.profiles)
+		items = append(items, profileItems...)
 
 		if err != nil {
-			return 0, err
+			return items, err
 		}
+	}
 
-		if len(recs) == 0 {
-			break
-		}
+	if opts.ledger || opts.ledgerAll {
+		ledgerItems, err := writeLedgers(opts.outDir, labels, opts.ledger, opts.ledgerAll)
+		items = append(items, ledgerItems...)
 
-		start = recs[0].Time.Unix()
-		end = recs[len(recs)-1].Time.Unix()
+		if err != nil {
+			return items, err
+		}
+	}
 
-		for i := range recs {
-			count++
-			f := recs[i]
+	if len(opts.journals) > 0 {
+		journalItems, err := writeJournals(opts.outDir, labels, opts.journals, opts.journal)
+		items = append(items, journalItems...)
 
-			csvWriter.Write([]string{
-				f.Coin,
-				f.Proceeds.String(),
-				f.Rate.String(),
-				f.Size.String(),
-				f.Time.String(),
-			})
+		if err != nil {
+			return items, err
 		}
 	}
 
-	csvWriter.Flush()
-	return count, nil
+	return items, nil
 }
 
-func fetchWithdrawals(client *goftx.Client, outFile string) (int64, error) {
-	since := time.Unix(0, 0)
-
-	file, err := os.Create(outFile)
+func accountLabel(subAcc string) string {
+	if subAcc == "" {
+		return "Main"
+	}
 
-	if err != nil {
-		return 0, err
-	}
-
-	defer file.Close()
-	csvWriter := csv.NewWriter(file)
-	csvWriter.Write([]string{
-		"Coin",
-		"Address",
-		"Tag",
-		"Fee",
-		"ID",
-		"Size",
-		"Status",
-		"Time",
-		"Method",
-		"Txid",
-		"Notes",
-	})
+	return subAcc
+}
 
-	start := since.Unix()
-	end := time.Now().Unix()
-	var count int64 = 0
+// subAccountOf is the inverse of accountLabel.
+func subAccountOf(label string) string {
+	if label == "Main" {
+		return ""
+	}
 
-	for {
-		limiter.Wait()
-		recs, err := client.GetWithdrawalHistory(start, end)
+	return label
+}
 
-		if err != nil {
-			return 0, err
-		}
+// newClient returns a client for the main account or a subaccount. Unless
+// disabled, every response it receives is saved to the raw archive.
+func newClient(opts *exportOptions, subAcc string) *goftx.Client {
+	clientOpts := []goftx.Option{goftx.WithAuth(opts.key, opts.secret)}
 
-		if len(recs) == 0 {
-			break
-		}
+	if subAcc != "" {
+		clientOpts = append(clientOpts, goftx.WithSubaccount(subAcc))
+	}
 
-		end = recs[len(recs)-1].Time.Unix()
-
-		for i := range recs {
-			count++
-			f := recs[i]
-
-			csvWriter.Write([]string{
-				f.Coin,
-				f.Address,
-				f.Tag,
-				f.Fee.String(),
-				fmt.Sprintf("%d", f.ID),
-				f.Size.String(),
-				f.Status,
-				f.Time.String(),
-				f.Method,
-				f.Txid,
-				f.Notes,
-			})
-		}
+	if !opts.noArchive {
+		clientOpts = append(clientOpts, goftx.WithHTTPClient(&http.Client{
+			Transport: newArchiveTransport(opts.outDir, accountLabel(subAcc), subAcc),
+		}))
 	}
 
-	csvWriter.Flush()
-	return count, nil
+	return goftx.New(clientOpts...)
 }
 
-func fetchDeposits(client *goftx.Client, outFile string) (int64, error) {
-	since := time.Unix(0, 0)
-
-	file, err := os.Create(outFile)
+// buildManifest describes the output files of the jobs as they are after the
+// run.
+func buildManifest(started time.Time, jobs []*exportJob, errs []error, runErrs []string) *manifest {
+	m := &manifest{
+		Tool:      "ftx-export",
+		Version:   version,
+		StartedAt: started,
+		Files:     make([]*manifestItem, 0, len(jobs)),
+		Errors:    runErrs,
+	}
 
-	if err != nil {
-		return 0, err
-	}
-
-	defer file.Close()
-	csvWriter := csv.NewWriter(file)
-	csvWriter.Write([]string{
-		"Coin",
-		"Confirmations",
-		"ConfirmedTime",
-		"Fee",
-		"ID",
-		"SentTime",
-		"Size",
-		"Status",
-		"Time",
-		"Txid",
-		"Notes",
-	})
+	for i, job := range jobs {
+		item := &manifestItem{
+			Path:       filepath.Base(job.outFile),
+			Subaccount: job.subAccount,
+			Dataset:    job.dataset,
+			Requested:  job.requested,
+		}
 
-	start := since.Unix()
-	end := time.Now().Unix()
-	var count int64 = 0
+		if errs[i] != nil {
+			item.Error = errs[i].Error()
+		}
 
-	for {
-		limiter.Wait()
-		recs, err := client.GetDepositHistory(start, end)
+		err := describeFile(job.outFile, job.timeColumn, item)
 
-		if err != nil {
-			return 0, err
+		if errors.Is(err, os.ErrNotExist) {
+			continue
 		}
 
-		if len(recs) == 0 {
-			break
+		if err != nil {
+			golog.Error(err)
+			item.Error = err.Error()
 		}
 
-		end = recs[len(recs)-1].Time.Unix()
-
-		for i := range recs {
-			count++
-			f := recs[i]
-
-			csvWriter.Write([]string{
-				f.Coin,
-				fmt.Sprintf("%d", f.Confirmations),
-				f.ConfirmedTime.String(),
-				f.Fee.String(),
-				fmt.Sprintf("%d", f.ID),
-				f.SentTime.String(),
-				f.Size.String(),
-				f.Status,
-				f.Time.String(),
-				f.Txid,
-				f.Notes,
-			})
-		}
+		m.Files = append(m.Files, item)
 	}
 
-	csvWriter.Flush()
-	return count, nil
+	m.FinishedAt = time.Now()
+	return m
 }
 
-func fetchTransactions(client *goftx.Client, outFile string) (int64, error) {
-	since := time.Unix(0, 0)
+// render rebuilds the output files of all archived accounts from the raw
+// archive without network access.
+func render(archiveFrom string, opts *exportOptions) error {
+	golog.Info("Rendering exports from the raw archive")
+	started := time.Now()
 
-	file, err := os.Create(outFile)
+	raw, err := openArchive(archiveFrom)
 
 	if err != nil {
-		return 0, err
-	}
-
-	defer file.Close()
-	csvWriter := csv.NewWriter(file)
-	csvWriter.Write([]string{
-		"ID",
-		"BaseCurrency",
-		"Fee",
-		"FeeCurrency",
-		"FeeRate",
-		"Future",
-		"Liquidity",
-		"Market",
-		"OrderID",
-		"Price",
-		"QuoteCurrency",
-		"Side",
-		"Size",
-		"Time",
-		"TradeID",
-		"Type",
-	})
+		return err
+	}
+
+	archived, err := raw.accounts()
 
-	start := int(since.Unix())
-	end := int(time.Now().Unix())
-	var count int64 = 0
+	if err != nil {
+		return err
+	}
 
-	for {
-		limiter.Wait()
-		fills, err := client.Fills.Fills(&models.FillsParams{
-			StartTime: &start,
-			EndTime:   &end,
-		})
+	var labels []string
 
-		if err != nil {
-			return 0, err
+	for _, label := range archived {
+		if opts.filter.account(label) {
+			labels = append(labels, label)
 		}
+	}
 
-		if len(fills) == 0 {
-			break
-		}
+	if err := os.MkdirAll(opts.outDir, 0777); err != nil {
+		return err
+	}
+
+	// Render rewrites every file, so it can change the format.
+	if err := setTextFormat(opts.outDir, opts.format, true); err != nil {
+		return err
+	}
+
+	sinks, err := openSinks(opts)
 
-		end = int(fills[len(fills)-1].Time.Time.Unix())
-
-		for i := range fills {
-			count++
-			f := fills[i]
-
-			csvWriter.Write([]string{
-				fmt.Sprintf("%d", f.ID),
-				f.BaseCurrency,
-				f.Fee.String(),
-				f.FeeCurrency,
-				f.FeeRate.String(),
-				f.Future,
-				string(f.Liquidity),
-				f.Market,
-				fmt.Sprintf("%d", f.OrderID),
-				f.Price.String(),
-				f.QuoteCurrency,
-				string(f.Side),
-				f.Size.String(),
-				f.Time.Time.String(),
-				fmt.Sprintf("%d", f.TradeID),
-				f.Type,
+	if err != nil {
+		return err
+	}
+
+	var jobs []*exportJob
+
+	for _, label := range labels {
+		for _, f := range fetchers {
+			jobs = append(jobs, &exportJob{
+				fetcher:    f,
+				subAccount: subAccountOf(label),
+				account:    label,
+				outFile:    exportPath(opts.outDir, label, f),
+				sinks:      sinks,
+				filter:     opts.filter,
 			})
 		}
 	}
 
-	csvWriter.Flush()
-	return count, nil
-}
+	failed := 0
+	errs := make([]error, len(jobs))
 
-func fetchRefRebates(client *goftx.Client, outFile string) (int64, error) {
-	file, err := os.Create(outFile)
+	for i, job := range jobs {
+		var count int64
+		count, errs[i] = job.ds.render(job, raw)
 
-	if err != nil {
-		return 0, err
+		golog.Infof("Rendered %d %s for %s", count, job.label, job.account)
+
+		if errs[i] != nil {
+			golog.Errorf("%s for %s: %v", job.label, job.account, errs[i])
+			failed++
+		}
 	}
 
-	defer file.Close()
-	csvWriter := csv.NewWriter(file)
-	csvWriter.Write([]string{
-		"Subaccount",
-		"Size",
-		"Day",
-	})
+	var runErrs []string
 
-	var count int64 = 0
+	if err := closeSinks(sinks); err != nil {
+		golog.Error(err)
+		runErrs = append(runErrs, err.Error())
+		failed++
+	}
 
-	limiter.Wait()
-	recs, err := client.GetReferralRebateHistory()
+	derivedItems, err := writeDerived(opts, labels)
 
 	if err != nil {
-		return 0, err
+		golog.Error(err)
+		runErrs = append(runErrs, err.Error())
+		failed++
 	}
 
-	for i := range recs {
-		count++
-		f := recs[i]
+	m := buildManifest(started, jobs, errs, runErrs)
+	m.Files = append(m.Files, derivedItems...)
+	m.Filter = opts.filter
+
+	if err := writeManifest(opts.outDir, m); err != nil {
+		return err
+	}
 
-		csvWriter.Write([]string{
-			f.Subaccount,
-			f.Size.String(),
-			f.Day.String(),
-		})
+	if failed > 0 {
+		return fmt.Errorf("%d renders failed", failed)
 	}
 
-	csvWriter.Flush()
-	return count, nil
+	return nil
 }
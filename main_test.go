@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenCSV(t *testing.T) {
+	const old = "Old,Header\nold,row\n"
+	done := &datasetState{Done: &checkpoint{Time: at(5), IDs: []string{"a"}}}
+	pending := &datasetState{Pending: &pendingState{Cursor: &checkpoint{Time: at(5), IDs: []string{"a"}}}}
+
+	tests := []struct {
+		name         string
+		existing     string
+		ds           *datasetState
+		full         bool
+		checkpointed bool
+		want         string
+		restarted    bool
+	}{
+		{"new file", "", nil, false, true, "ID\n1\n", true},
+		{"continued", "ID\n0\n", done, false, true, "ID\n0\n1\n", false},
+		{"resumed", "ID\n0\n", pending, false, true, "ID\n0\n1\n", false},
+		{"full", "ID\n0\n", done, true, true, "ID\n1\n", true},
+		{"lost state", old, nil, false, true, "ID\n1\n", true},
+		{"snapshot", "ID\n0\n", nil, false, false, "ID\n0\n1\n", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s, err := loadState(filepath.Join(dir, stateFile))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.ds != nil {
+				*s.dataset("Main", "fills") = *tt.ds
+			}
+
+			path := filepath.Join(dir, "Main_fills.csv")
+
+			if tt.existing != "" {
+				if err := os.WriteFile(path, []byte(tt.existing), 0666); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			job := &exportJob{fetcher: fetcher{dataset: "fills"}, state: s, account: "Main", outFile: path, full: tt.full}
+			file, csvWriter, err := job.openCSV([]string{"ID"}, tt.checkpointed)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			csvWriter.Write([]string{"1"})
+			csvWriter.Flush()
+			file.Close()
+
+			data, err := os.ReadFile(path)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(data) != tt.want {
+				t.Errorf("file = %q, want %q", data, tt.want)
+			}
+
+			if job.restarted != tt.restarted {
+				t.Errorf("restarted = %v, want %v", job.restarted, tt.restarted)
+			}
+		})
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const manifestFile = "manifest.json"
+
+// version is set at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
+// manifest is the audit trail of an export run. It describes every file of
+// the output directory as it was after the run.
+type manifest struct {
+	Tool       string          `json:"tool"`
+	Version    string          `json:"version"`
+	StartedAt  time.Time       `json:"startedAt"`
+	FinishedAt time.Time       `json:"finishedAt"`
+	Files      []*manifestItem `json:"files"`
+	Errors     []string        `json:"errors,omitempty"`
+	// Filter the files were written with, nil for complete exports.
+	Filter *exportFilter `json:"filter,omitempty"`
+}
+
+type manifestItem struct {
+	Path       string `json:"path"`
+	Subaccount string `json:"subaccount"`
+	Dataset    string `json:"dataset"`
+	Rows       int64  `json:"rows"`
+	SHA256     string `json:"sha256"`
+	// Timestamps of the oldest and newest record in the file.
+	FirstRecord *time.Time `json:"firstRecord,omitempty"`
+	LastRecord  *time.Time `json:"lastRecord,omitempty"`
+	// Time range requested from the API by this run.
+	Requested *timeRange `json:"requested,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	// Delimiter of a CSV file that is written in the fixed format of another
+	// tool instead of the text format.
+	Delimiter string `json:"delimiter,omitempty"`
+}
+
+type timeRange struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// extend grows the range so it also covers start to end.
+func (r *timeRange) extend(start, end time.Time) *timeRange {
+	if r == nil {
+		return &timeRange{Start: start, End: end}
+	}
+
+	if start.Before(r.Start) {
+		r.Start = start
+	}
+
+	if end.After(r.End) {
+		r.End = end
+	}
+
+	return r
+}
+
+// describeFile fills in the row count, checksum and record time range of a
+// file. timeColumn names the CSV column holding the record timestamps.
+func describeFile(path, timeColumn string, item *manifestItem) error {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	hash := sha256.New()
+	tee := io.TeeReader(file, hash)
+
+	if filepath.Ext(path) == ".csv" {
+		err = countRecords(tee, timeColumn, item)
+	} else {
+		item.Rows = 1
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(io.Discard, tee); err != nil {
+		return err
+	}
+
+	item.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return nil
+}
+
+func countRecords(r io.Reader, timeColumn string, item *manifestItem) error {
+	reader := outFormat.csvReader(r)
+
+	if item.Delimiter != "" {
+		reader.Comma = []rune(item.Delimiter)[0]
+	}
+	header, err := reader.Read()
+
+	if err == io.EOF {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	col := -1
+
+	for i, name := range header {
+		if name == timeColumn {
+			col = i
+		}
+	}
+
+	for {
+		rec, err := reader.Read()
+
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		item.Rows++
+
+		if col < 0 || col >= len(rec) {
+			continue
+		}
+
+		t, err := parseRecordTime(rec[col])
+
+		if err != nil {
+			continue
+		}
+
+		if item.FirstRecord == nil || t.Before(*item.FirstRecord) {
+			item.FirstRecord = &t
+		}
+
+		if item.LastRecord == nil || t.After(*item.LastRecord) {
+			item.LastRecord = &t
+		}
+	}
+}
+
+// parseRecordTime parses the timestamps of the CSV files.
+func parseRecordTime(s string) (time.Time, error) {
+	return outFormat.parseTime(s)
+}
+
+func writeManifest(dir string, m *manifest) error {
+	data, err := json.MarshalIndent(m, "", " ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, manifestFile), data, 0666)
+}
+
+func loadManifest(dir string) (*manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+
+	if err != nil {
+		return nil, err
+	}
+
+	m := &manifest{}
+
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("%s: %w", manifestFile, err)
+	}
+
+	return m, nil
+}
+
+// addToManifest records files written into an exported directory after the
+// export, like reports, in its manifest. Items replace those with the same
+// path. Directories without a manifest are left alone.
+func addToManifest(dir string, items ...*manifestItem) error {
+	m, err := loadManifest(dir)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if err := describeFile(filepath.Join(dir, item.Path), "", item); err != nil {
+			return err
+		}
+
+		replaced := false
+
+		for i, old := range m.Files {
+			if old.Path == item.Path {
+				m.Files[i] = item
+				replaced = true
+			}
+		}
+
+		if !replaced {
+			m.Files = append(m.Files, item)
+		}
+	}
+
+	return writeManifest(dir, m)
+}
+
+// addReportToManifest adds a report file to the manifest of dir when it was
+// written directly into dir.
+func addReportToManifest(dir, path, dataset string) error {
+	rel, err := filepath.Rel(dir, path)
+
+	if err != nil || strings.Contains(rel, string(filepath.Separator)) || strings.HasPrefix(rel, "..") {
+		return nil
+	}
+
+	return addToManifest(dir, &manifestItem{Path: rel, Dataset: dataset})
+}
+
+// verifyDir checks the files of an output directory against its manifest and
+// writes one line per problem to out. It returns the number of problems.
+func verifyDir(dir string, out io.Writer) (int, error) {
+	m, err := loadManifest(dir)
+
+	if err != nil {
+		return 0, err
+	}
+
+	problems := 0
+	listed := map[string]bool{}
+
+	for _, item := range m.Files {
+		listed[item.Path] = true
+
+		if item.SHA256 == "" {
+			continue
+		}
+
+		got := &manifestItem{Delimiter: item.Delimiter}
+		err := describeFile(filepath.Join(dir, item.Path), "", got)
+
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			fmt.Fprintf(out, "missing: %s\n", item.Path)
+			problems++
+		case err != nil:
+			fmt.Fprintf(out, "unreadable: %s: %v\n", item.Path, err)
+			problems++
+		case got.Rows != item.Rows:
+			fmt.Fprintf(out, "row count mismatch: %s: manifest %d, file %d\n", item.Path, item.Rows, got.Rows)
+			problems++
+		case got.SHA256 != item.SHA256:
+			fmt.Fprintf(out, "checksum mismatch: %s\n", item.Path)
+			problems++
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+
+	if err != nil {
+		return problems, err
+	}
+
+	var extra []string
+
+	for _, e := range entries {
+		name := e.Name()
+		ext := filepath.Ext(name)
+
+		if e.IsDir() || listed[name] || name == manifestFile || name == stateFile || name == formatFile || (ext != ".csv" && ext != ".json") {
+			continue
+		}
+
+		extra = append(extra, name)
+	}
+
+	sort.Strings(extra)
+
+	for _, name := range extra {
+		fmt.Fprintf(out, "not in manifest: %s\n", name)
+		problems++
+	}
+
+	return problems, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyDir(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(dir string) error
+		want   string
+	}{
+		{"unchanged", func(string) error { return nil }, ""},
+		{
+			name: "tampered",
+			change: func(dir string) error {
+				return os.WriteFile(filepath.Join(dir, "Main_transaction_history.csv"), []byte("ID,Price\n1,21000\n2,30000\n"), 0666)
+			},
+			want: "checksum mismatch: Main_transaction_history.csv\n",
+		},
+		{
+			name: "row added",
+			change: func(dir string) error {
+				return os.WriteFile(filepath.Join(dir, "Main_transaction_history.csv"), []byte("ID,Price\n1,20000\n2,30000\n3,40000\n"), 0666)
+			},
+			want: "row count mismatch: Main_transaction_history.csv: manifest 2, file 3\n",
+		},
+		{
+			name: "missing",
+			change: func(dir string) error {
+				return os.Remove(filepath.Join(dir, "Main_transaction_history.csv"))
+			},
+			want: "missing: Main_transaction_history.csv\n",
+		},
+		{
+			name: "extra",
+			change: func(dir string) error {
+				return os.WriteFile(filepath.Join(dir, "Main_notes.csv"), []byte("Note\n"), 0666)
+			},
+			want: "not in manifest: Main_notes.csv\n",
+		},
+		{
+			name: "other files",
+			change: func(dir string) error {
+				return os.WriteFile(filepath.Join(dir, "README.txt"), []byte("notes"), 0666)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "Main_transaction_history.csv")
+
+			if err := os.WriteFile(path, []byte("ID,Price\n1,20000\n2,30000\n"), 0666); err != nil {
+				t.Fatal(err)
+			}
+
+			item := &manifestItem{Path: filepath.Base(path), Dataset: "transaction_history"}
+
+			if err := describeFile(path, "", item); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := writeManifest(dir, &manifest{Files: []*manifestItem{item}}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := tt.change(dir); err != nil {
+				t.Fatal(err)
+			}
+
+			var out bytes.Buffer
+			problems, err := verifyDir(dir, &out)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if out.String() != tt.want {
+				t.Errorf("output = %q, want %q", out.String(), tt.want)
+			}
+
+			if want := bytes.Count([]byte(tt.want), []byte("\n")); problems != want {
+				t.Errorf("problems = %d, want %d", problems, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/grishinsana/goftx"
+	"github.com/grishinsana/goftx/models"
+	"github.com/shopspring/decimal"
+)
+
+// optionName describes an option, "BTC call 50000 2022-03-25".
+func optionName(underlying, typ string, strike decimal.Decimal, expiry time.Time) string {
+	return fmt.Sprintf("%s %s %s %s", underlying, typ, strike, expiry.UTC().Format("2006-01-02"))
+}
+
+// The options fills are the trades of the account, /options/trades is the
+// public trade feed of all accounts. Premiums and fees are paid in USD.
+var optionFillsDataset = &csvDataset[*models.OptionFill]{
+	endpoints: []string{"/options/fills"},
+	columns: &table{
+		name: "options_fills",
+		columns: []column{
+			{name: "ID", kind: kindInt},
+			{name: "Underlying", kind: kindString},
+			{name: "Type", kind: kindString},
+			{name: "Strike", kind: kindDecimal},
+			{name: "Expiry", kind: kindTime},
+			{name: "Side", kind: kindString},
+			{name: "Price", kind: kindDecimal},
+			{name: "Size", kind: kindDecimal},
+			{name: "Fee", kind: kindDecimal},
+			{name: "FeeRate", kind: kindDecimal},
+			{name: "Liquidity", kind: kindString},
+			{name: "Time", kind: kindTime},
+		},
+		primaryKey: []string{"id"},
+		indexes:    []string{"time", "underlying"},
+	},
+	fetch: func(client *goftx.Client, _ *exportFilter) pageFunc[*models.OptionFill] {
+		return client.Options.GetOptionsFills
+	},
+	pageSize: ftxPageSize,
+	key: func(f *models.OptionFill) (time.Time, string) {
+		return f.Time, strconv.FormatInt(f.ID, 10)
+	},
+	subject: func(f *models.OptionFill) ([]string, string) {
+		return []string{f.Option.Underlying}, ""
+	},
+	values: func(f *models.OptionFill) []interface{} {
+		return []interface{}{
+			f.ID,
+			f.Option.Underlying,
+			string(f.Option.Type),
+			f.Option.Strike,
+			f.Option.Expiry,
+			string(f.Side),
+			f.Price,
+			f.Size,
+			f.Fee,
+			f.FeeRate,
+			f.Liquidity,
+			f.Time,
+		}
+	},
+}
+
+var optionPositionsDataset = &snapshotDataset[*models.OptionPosition]{
+	endpoint: "/options/positions",
+	columns: &table{
+		name: "options_positions",
+		columns: []column{
+			{name: "Time", kind: kindTime},
+			{name: "Underlying", kind: kindString},
+			{name: "Type", kind: kindString},
+			{name: "Strike", kind: kindDecimal},
+			{name: "Expiry", kind: kindTime},
+			{name: "Side", kind: kindString},
+			{name: "Size", kind: kindDecimal},
+			{name: "NetSize", kind: kindDecimal},
+			{name: "EntryPrice", kind: kindDecimal},
+		},
+		primaryKey: []string{"subaccount", "time", "underlying", "type", "strike", "expiry"},
+		indexes:    []string{"time", "underlying"},
+	},
+	fetch: func(client *goftx.Client) ([]*models.OptionPosition, error) {
+		return client.Options.GetOptionsPositions()
+	},
+	subject: func(p *models.OptionPosition) ([]string, string) {
+		return []string{p.Option.Underlying}, ""
+	},
+	values: func(p *models.OptionPosition) []interface{} {
+		return []interface{}{
+			p.Option.Underlying,
+			string(p.Option.Type),
+			p.Option.Strike,
+			p.Option.Expiry,
+			string(p.Side),
+			p.Size,
+			p.NetSize,
+			p.EntryPrice,
+		}
+	},
+}
+
+// optionOf describes the option of an exported options record.
+func optionOf(r record) string {
+	return optionName(r.str("underlying"), r.str("type"), r.dec("strike"), r.time("expiry"))
+}
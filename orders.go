@@ -0,0 +1,342 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grishinsana/goftx"
+	"github.com/grishinsana/goftx/models"
+	"github.com/kataras/golog"
+)
+
+// marketCoins returns the coins of a market, the base and quote coin of a
+// spot market and the coin of a future.
+func marketCoins(market, future string) []string {
+	if future != "" {
+		return []string{underlying(future)}
+	}
+
+	base, quote, ok := strings.Cut(market, "/")
+
+	if !ok {
+		return []string{underlying(market)}
+	}
+
+	return []string{base, quote}
+}
+
+// Orders include cancelled orders and orders that never filled. Fills refer to
+// their order by OrderID.
+var ordersDataset = &csvDataset[*models.Order]{
+	endpoints: []string{"/orders/history"},
+	columns: &table{
+		name: "orders",
+		columns: []column{
+			{name: "ID", kind: kindInt},
+			{name: "ClientID", kind: kindString},
+			{name: "Market", kind: kindString},
+			{name: "Future", kind: kindString},
+			{name: "Type", kind: kindString},
+			{name: "Side", kind: kindString},
+			{name: "Price", kind: kindDecimal},
+			{name: "Size", kind: kindDecimal},
+			{name: "FilledSize", kind: kindDecimal},
+			{name: "RemainingSize", kind: kindDecimal},
+			{name: "AvgFillPrice", kind: kindDecimal},
+			{name: "Status", kind: kindString},
+			{name: "ReduceOnly", kind: kindBool},
+			{name: "Ioc", kind: kindBool},
+			{name: "PostOnly", kind: kindBool},
+			{name: "CreatedAt", kind: kindTime},
+		},
+		primaryKey: []string{"id"},
+		indexes:    []string{"created_at", "market"},
+	},
+	fetch: func(client *goftx.Client, filter *exportFilter) pageFunc[*models.Order] {
+		return ordersPage(client, filter.market())
+	},
+	pageSize: ftxPageSize,
+	fetchMarket: func(client *goftx.Client, market string) pageFunc[*models.Order] {
+		return ordersPage(client, &market)
+	},
+	key: func(o *models.Order) (time.Time, string) {
+		return o.CreatedAt, strconv.FormatInt(o.ID, 10)
+	},
+	subject: func(o *models.Order) ([]string, string) {
+		return marketCoins(o.Market, o.Future), o.Market
+	},
+	values: func(o *models.Order) []interface{} {
+		return []interface{}{
+			o.ID,
+			o.ClientID,
+			o.Market,
+			o.Future,
+			string(o.Type),
+			string(o.Side),
+			o.Price,
+			o.Size,
+			o.FilledSize,
+			o.RemainingSize,
+			o.AvgFillPrice,
+			string(o.Status),
+			o.ReduceOnly,
+			o.Ioc,
+			o.PostOnly,
+			o.CreatedAt,
+		}
+	},
+}
+
+// ordersPage fetches the order history of a market, or of all markets when
+// market is nil.
+func ordersPage(client *goftx.Client, market *string) pageFunc[*models.Order] {
+	return func(start, end int64) ([]*models.Order, error) {
+		startTime := int(start)
+		endTime := int(end)
+
+		return client.Orders.GetOrdersHistory(&models.GetOrdersHistoryParams{
+			Market:    market,
+			StartTime: &startTime,
+			EndTime:   &endTime,
+		})
+	}
+}
+
+// triggerOrder is a stop, take profit or trailing stop order with the orders
+// it placed when it was triggered.
+type triggerOrder struct {
+	models.TriggerOrder
+	triggers []*models.Trigger
+	// open is set for open orders merged into a page of the history.
+	open bool
+}
+
+const orderTriggersEndpoint = "/conditional_orders/%d/triggers"
+
+// The trigger order history is completed with the open trigger orders, which
+// are fetched once per export and merged into the pages of their time. Open
+// orders older than a page are left to the later pages, so they never move
+// the end of the next page past records of the history. Only the history
+// fills a page, the open orders don't count toward its size.
+var triggerOrdersDataset = &csvDataset[*triggerOrder]{
+	endpoints: []string{"/conditional_orders/history", "/conditional_orders"},
+	columns: &table{
+		name: "trigger_orders",
+		columns: []column{
+			{name: "ID", kind: kindInt},
+			{name: "Market", kind: kindString},
+			{name: "Future", kind: kindString},
+			{name: "Type", kind: kindString},
+			{name: "OrderType", kind: kindString},
+			{name: "Side", kind: kindString},
+			{name: "Size", kind: kindDecimal},
+			{name: "TriggerPrice", kind: kindDecimal},
+			{name: "OrderPrice", kind: kindDecimal},
+			{name: "TrailValue", kind: kindDecimal},
+			{name: "TrailStart", kind: kindDecimal},
+			{name: "ReduceOnly", kind: kindBool},
+			{name: "RetryUntilFilled", kind: kindBool},
+			{name: "Status", kind: kindString},
+			{name: "OrderStatus", kind: kindString},
+			{name: "FilledSize", kind: kindDecimal},
+			{name: "AvgFillPrice", kind: kindDecimal},
+			{name: "Error", kind: kindString},
+			{name: "CreatedAt", kind: kindTime},
+			{name: "TriggeredAt", kind: kindTime},
+			// The orders placed by the trigger as JSON, their orderId is
+			// the ID of the order history.
+			{name: "Triggers", kind: kindString},
+		},
+		primaryKey: []string{"id"},
+		indexes:    []string{"created_at", "market"},
+	},
+	fetch: func(client *goftx.Client, filter *exportFilter) pageFunc[*triggerOrder] {
+		var open []*models.TriggerOrder
+		fetchedOpen := false
+
+		return func(start, end int64) ([]*triggerOrder, error) {
+			startTime := int(start)
+			endTime := int(end)
+
+			history, err := client.Orders.GetTriggerOrdersHistory(&models.GetTriggerOrdersHistoryParams{
+				Market:    filter.market(),
+				StartTime: &startTime,
+				EndTime:   &endTime,
+			})
+
+			if err != nil {
+				return nil, err
+			}
+
+			if !fetchedOpen {
+				open, err = client.Orders.GetOpenTriggerOrders(&models.GetOpenTriggerOrdersParams{Market: filter.market()})
+
+				if err != nil {
+					return nil, err
+				}
+
+				fetchedOpen = true
+			}
+
+			page := make([]*triggerOrder, 0, len(history))
+			seen := map[int64]bool{}
+			oldest := time.Unix(start, 0)
+
+			for _, o := range history {
+				page = append(page, &triggerOrder{TriggerOrder: *o})
+				seen[o.ID] = true
+
+				if len(page) == 1 || o.CreatedAt.Before(oldest) {
+					oldest = o.CreatedAt
+				}
+			}
+
+			for _, o := range open {
+				t := o.CreatedAt
+
+				if !seen[o.ID] && !t.Before(oldest) && t.Unix() >= start && t.Unix() <= end {
+					page = append(page, &triggerOrder{TriggerOrder: *o, open: true})
+				}
+			}
+
+			return page, nil
+		}
+	},
+	pageSize: ftxPageSize,
+	paged: func(o *triggerOrder) bool {
+		return !o.open
+	},
+	key: func(o *triggerOrder) (time.Time, string) {
+		return o.CreatedAt, strconv.FormatInt(o.ID, 10)
+	},
+	subject: func(o *triggerOrder) ([]string, string) {
+		return marketCoins(o.Market, o.Future), o.Market
+	},
+	enrich: func(job *exportJob, raw *archive, recs []*triggerOrder) error {
+		var archived map[string]json.RawMessage
+
+		for _, o := range recs {
+			if o.TriggeredAt.IsZero() {
+				continue
+			}
+
+			endpoint := fmt.Sprintf(orderTriggersEndpoint, o.ID)
+
+			if raw != nil {
+				if archived == nil {
+					var err error
+					archived, err = raw.pagesByEndpoint(job.account, endpoint)
+
+					if err != nil {
+						return err
+					}
+				}
+
+				page, ok := archived[endpoint]
+
+				if !ok {
+					continue
+				}
+
+				if err := json.Unmarshal(page, &o.triggers); err != nil {
+					return fmt.Errorf("%s: %w", endpoint, err)
+				}
+
+				continue
+			}
+
+			triggers, err := call(job.ctx, func() ([]*models.Trigger, error) {
+				return job.client.Orders.GetOrderTriggers(o.ID)
+			})
+
+			if err != nil {
+				return fmt.Errorf("%s: %w", endpoint, err)
+			}
+
+			o.triggers = triggers
+		}
+
+		return nil
+	},
+	values: func(o *triggerOrder) []interface{} {
+		triggers := ""
+
+		if len(o.triggers) > 0 {
+			data, _ := json.Marshal(o.triggers)
+			triggers = string(data)
+		}
+
+		return []interface{}{
+			o.ID,
+			o.Market,
+			o.Future,
+			string(o.Type),
+			string(o.OrderType),
+			string(o.Side),
+			o.Size,
+			o.TriggerPrice,
+			o.OrderPrice,
+			o.TrailValue,
+			o.TrailStart,
+			o.ReduceOnly,
+			o.RetryUntilFilled,
+			string(o.Status),
+			o.OrderStatus,
+			o.FilledSize,
+			o.AvgFillPrice,
+			o.Error,
+			o.CreatedAt,
+			o.TriggeredAt,
+			triggers,
+		}
+	},
+}
+
+// checkOrderLinks warns about the fills of every account whose order is not in
+// the order history. Fills without an order, like liquidations, are skipped.
+func checkOrderLinks(dir string, accounts []string) error {
+	for _, account := range accounts {
+		orders, err := loadRecords(dir, account, "order_history")
+
+		if err != nil {
+			return err
+		}
+
+		fills, err := loadRecords(dir, account, "transaction_history")
+
+		if err != nil {
+			return err
+		}
+
+		known := make(map[int64]bool, len(orders))
+
+		for _, o := range orders {
+			known[o.int("id")] = true
+		}
+
+		missing, linked := 0, 0
+
+		for _, f := range fills {
+			id := f.int("order_id")
+
+			if id == 0 {
+				continue
+			}
+
+			linked++
+
+			if !known[id] {
+				missing++
+			}
+		}
+
+		if missing > 0 {
+			golog.Warnf("%d of %d fills of %s have no order in the order history", missing, linked, account)
+		}
+	}
+
+	return nil
+}
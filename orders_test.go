@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/grishinsana/goftx"
+)
+
+// triggerOrdersServer answers the trigger order history with at most
+// ftxPageSize orders between start_time and end_time and the open trigger
+// orders with all of open.
+func triggerOrdersServer(history, open []map[string]interface{}) roundTripFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		page := []map[string]interface{}{}
+
+		if strings.HasSuffix(req.URL.Path, "/history") {
+			start, _ := strconv.ParseInt(req.URL.Query().Get("start_time"), 10, 64)
+			end, _ := strconv.ParseInt(req.URL.Query().Get("end_time"), 10, 64)
+
+			for _, o := range history {
+				if sec := o["_sec"].(int); int64(sec) >= start && int64(sec) <= end && len(page) < ftxPageSize {
+					page = append(page, o)
+				}
+			}
+		} else {
+			page = open
+		}
+
+		body, err := json.Marshal(map[string]interface{}{"success": true, "result": page})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(bytes.NewReader(body)), Request: req}, nil
+	}
+}
+
+// TestTriggerOrdersPageSize checks that open orders merged into a page of the
+// history don't make it full. A history page one short of full with an open
+// order of the same second would otherwise look like a truncated second.
+func TestTriggerOrdersPageSize(t *testing.T) {
+	order := func(id int, status string) map[string]interface{} {
+		tm := at(1)
+		return map[string]interface{}{
+			"id": id, "market": "BTC-PERP", "future": "BTC-PERP", "side": "sell", "size": "1", "triggerPrice": "30000",
+			"type": "stop", "orderType": "market", "status": status, "createdAt": tm.Format("2006-01-02T15:04:05Z07:00"), "_sec": int(tm.Unix()),
+		}
+	}
+
+	var history []map[string]interface{}
+
+	for id := 1; id < ftxPageSize; id++ {
+		history = append(history, order(id, "cancelled"))
+	}
+
+	open := []map[string]interface{}{order(ftxPageSize, "open")}
+
+	dir := t.TempDir()
+	client := goftx.New(goftx.WithAuth("key", "secret"), goftx.WithHTTPClient(&http.Client{Transport: triggerOrdersServer(history, open)}))
+	f := fetcherOf("trigger_order_history")
+	state, err := loadState(filepath.Join(dir, stateFile))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := &exportJob{fetcher: f, ctx: context.Background(), client: client, state: state, account: "Main", outFile: exportPath(dir, "Main", f)}
+
+	if n, err := f.ds.export(job); err != nil || n != int64(len(history)+len(open)) {
+		t.Fatalf("export = %d, %v, want %d records", n, err, len(history)+len(open))
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ftxPageSize is the most records the paginated FTX endpoints return for one
+// request.
+const ftxPageSize = 100
+
+// errTruncatedPage is returned when more records share a second than fit on
+// a page and the second can't be fetched in smaller parts.
+var errTruncatedPage = errors.New("page truncated by the API")
+
+// pageFunc fetches the records between start and end, both inclusive unix
+// seconds.
+type pageFunc[T any] func(start, end int64) ([]T, error)
+
+// keyFunc returns the timestamp and the ID of a record.
+type keyFunc[T any] func(rec T) (time.Time, string)
+
+// pager describes how the records of an endpoint are fetched.
+type pager[T any] struct {
+	fetch pageFunc[T]
+	key   keyFunc[T]
+	// size is the page size of the endpoint, 0 when it returns every record
+	// of the window at once.
+	size int
+	// paged, when set, reports whether a record counts toward the page size.
+	paged func(rec T) bool
+	// second, when set, fetches every record of a single second that filled
+	// the page, for example market by market.
+	second func(sec int64, page []T) ([]T, error)
+}
+
+// full reports whether a page holds as many records as the endpoint returns,
+// so older records of the window may be cut off.
+func (p *pager[T]) full(page []T) bool {
+	if p.size == 0 {
+		return false
+	}
+
+	n := len(page)
+
+	if p.paged != nil {
+		n = 0
+
+		for _, rec := range page {
+			if p.paged(rec) {
+				n++
+			}
+		}
+	}
+
+	return n >= p.size
+}
+
+// paginate walks backwards through the window one page at a time and calls
+// emit with the records that have not been written yet, newest first. The
+// records are added to the window after emit returned and the progress is
+// saved.
+//
+// The end of the next page is the second of the oldest record of the current
+// page, so records sharing that second are fetched again and removed by their
+// ID. A page that brings no new records moves the end below its oldest
+// second. The end therefore decreases with every request and the walk always
+// terminates. A full page that holds a single second can't be split with
+// second based windows, it is fetched with p.second instead. The walk fails
+// when there is none or the split misses a record of the page, so the window
+// is not recorded as complete.
+func paginate[T any](w *window, p *pager[T], emit func(recs []T) error) error {
+	start := w.start().Unix()
+	end := ceilUnix(w.until)
+
+	for end >= start {
+		page, err := p.fetch(start, end)
+
+		if err != nil {
+			return err
+		}
+
+		recs := p.sorted(page, start, end)
+
+		if len(recs) == 0 {
+			return nil
+		}
+
+		newest, _ := p.key(recs[0])
+		oldest, _ := p.key(recs[len(recs)-1])
+		split := p.full(page) && newest.Unix() == oldest.Unix()
+
+		if split {
+			sec := oldest.Unix()
+
+			if p.second == nil {
+				return fmt.Errorf("%w: %d records share the second %s", errTruncatedPage, len(page), oldest.UTC().Format(time.RFC3339))
+			}
+
+			all, err := p.second(sec, recs)
+
+			if err != nil {
+				return err
+			}
+
+			if err := p.covers(all, recs); err != nil {
+				return err
+			}
+
+			recs = p.sorted(all, sec, sec)
+		}
+
+		fresh := make([]T, 0, len(recs))
+
+		for _, rec := range recs {
+			if t, id := p.key(rec); !w.written(t, id) {
+				fresh = append(fresh, rec)
+			}
+		}
+
+		if len(fresh) > 0 {
+			if err := emit(fresh); err != nil {
+				return err
+			}
+
+			for _, rec := range fresh {
+				w.add(p.key(rec))
+			}
+
+			if err := w.save(); err != nil {
+				return err
+			}
+		}
+
+		// The second was fetched completely, the next page ends below it.
+		if split {
+			end = oldest.Unix() - 1
+			continue
+		}
+
+		next := ceilUnix(oldest)
+
+		if len(fresh) > 0 && next < end {
+			end = next
+			continue
+		}
+
+		if next > end-1 {
+			next = end
+		}
+
+		end = next - 1
+	}
+
+	return nil
+}
+
+// sorted returns the records of a page between start and end, newest first.
+func (p *pager[T]) sorted(page []T, start, end int64) []T {
+	recs := make([]T, 0, len(page))
+
+	for _, rec := range page {
+		t, _ := p.key(rec)
+
+		if t.Unix() >= start && t.Unix() <= end {
+			recs = append(recs, rec)
+		}
+	}
+
+	sort.SliceStable(recs, func(a, b int) bool {
+		ta, _ := p.key(recs[a])
+		tb, _ := p.key(recs[b])
+		return ta.After(tb)
+	})
+
+	return recs
+}
+
+// covers checks that the records fetched for a second hold every record of
+// the page they replace, a market missing from the split would lose records.
+func (p *pager[T]) covers(all, page []T) error {
+	ids := make(map[string]bool, len(all))
+
+	for _, rec := range all {
+		_, id := p.key(rec)
+		ids[id] = true
+	}
+
+	for _, rec := range page {
+		if t, id := p.key(rec); !ids[id] {
+			return fmt.Errorf("%w: record %s of the second %s is missing when fetched by market", errTruncatedPage, id, t.UTC().Format(time.RFC3339))
+		}
+	}
+
+	return nil
+}
+
+// byMarket fetches a second market by market, for endpoints that can be
+// narrowed to a market. markets lists the markets that may have records at a
+// time, the markets of the records of the page are added to them. It fails
+// when a single market still fills a page.
+func byMarket[T any](markets func(at time.Time) ([]string, error), market func(rec T) string, fetch func(market string) pageFunc[T], size int) func(sec int64, page []T) ([]T, error) {
+	return func(sec int64, page []T) ([]T, error) {
+		at := time.Unix(sec, 0)
+		names, err := markets(at)
+
+		if err != nil {
+			return nil, err
+		}
+
+		seen := make(map[string]bool, len(names))
+
+		for _, name := range names {
+			seen[name] = true
+		}
+
+		for _, rec := range page {
+			if name := market(rec); name != "" && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+
+		var recs []T
+
+		for _, name := range names {
+			page, err := fetch(name)(sec, sec)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if size > 0 && len(page) >= size {
+				return nil, fmt.Errorf("%w: %d records of %s share the second %s", errTruncatedPage, len(page), name, at.UTC().Format(time.RFC3339))
+			}
+
+			recs = append(recs, page...)
+		}
+
+		return recs, nil
+	}
+}
+
+// ceilUnix returns t in unix seconds, rounded up so a window ending at the
+// result still includes t.
+func ceilUnix(t time.Time) int64 {
+	sec := t.Unix()
+
+	if t.After(time.Unix(sec, 0)) {
+		sec++
+	}
+
+	return sec
+}
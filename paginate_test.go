@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+type pageRec struct {
+	sec    int
+	id     string
+	market string
+}
+
+func (r pageRec) time() time.Time {
+	return stateBase.Add(time.Duration(r.sec) * time.Second)
+}
+
+// endpoint serves the records of a market, or of all markets when market is
+// empty, newest first and at most size per request when size is set.
+func endpoint(recs []pageRec, size int, market string) pageFunc[pageRec] {
+	return func(start, end int64) ([]pageRec, error) {
+		var page []pageRec
+
+		for _, r := range recs {
+			if t := r.time().Unix(); t >= start && t <= end && (market == "" || r.market == market) {
+				page = append(page, r)
+			}
+		}
+
+		sort.SliceStable(page, func(a, b int) bool {
+			return page[a].sec > page[b].sec
+		})
+
+		if size > 0 && len(page) > size {
+			page = page[:size]
+		}
+
+		return page, nil
+	}
+}
+
+// testPager splits full seconds by the given markets, none when nil.
+func testPager(recs []pageRec, size int, markets []string) *pager[pageRec] {
+	p := &pager[pageRec]{
+		fetch: endpoint(recs, size, ""),
+		key: func(r pageRec) (time.Time, string) {
+			return r.time(), r.id
+		},
+		size: size,
+	}
+
+	if markets != nil {
+		p.second = byMarket(func(time.Time) ([]string, error) {
+			return markets, nil
+		}, func(r pageRec) string {
+			return r.market
+		}, func(market string) pageFunc[pageRec] {
+			return endpoint(recs, size, market)
+		}, size)
+	}
+
+	return p
+}
+
+// exportPages runs paginate over the first hour after stateBase and returns
+// the IDs in the order they were emitted.
+func exportPages(s *exportState, p *pager[pageRec], stopAfter int) ([]string, error) {
+	var ids []string
+
+	err := s.eachWindow("Main", "fills", stateBase, stateBase.Add(time.Hour), func(w *window) error {
+		return paginate(w, p, func(recs []pageRec) error {
+			if stopAfter > 0 && len(ids) >= stopAfter {
+				return errors.New("interrupted")
+			}
+
+			for _, r := range recs {
+				ids = append(ids, r.id)
+			}
+
+			return nil
+		})
+	})
+
+	return ids, err
+}
+
+var allMarkets = []string{"BTC-PERP", "ETH-PERP", "SOL-PERP"}
+
+func TestPaginate(t *testing.T) {
+	tests := []struct {
+		name    string
+		recs    []pageRec
+		size    int
+		markets []string
+		want    []string
+		err     error
+	}{
+		{
+			name: "records of a second on two pages",
+			recs: []pageRec{{10, "a", ""}, {10, "b", ""}, {9, "c", ""}, {9, "d", ""}, {8, "e", ""}, {8, "f", ""}, {7, "g", ""}},
+			size: 3,
+			want: []string{"a", "b", "c", "d", "e", "f", "g"},
+		},
+		{
+			name: "whole history at once",
+			recs: []pageRec{{30, "a", ""}, {30, "b", ""}, {30, "c", ""}, {20, "d", ""}},
+			want: []string{"a", "b", "c", "d"},
+		},
+		{
+			name:    "full second split by market",
+			recs:    []pageRec{{10, "a", "BTC-PERP"}, {9, "b", "BTC-PERP"}, {9, "c", "ETH-PERP"}, {9, "d", "SOL-PERP"}, {8, "e", "BTC-PERP"}},
+			size:    2,
+			markets: allMarkets,
+			want:    []string{"a", "b", "c", "d", "e"},
+		},
+		{
+			name:    "market missing from the market list",
+			recs:    []pageRec{{10, "a", "BTC-PERP"}, {9, "b", "BTC-PERP"}, {9, "c", "BTC-0325"}, {9, "d", "ETH-PERP"}},
+			size:    2,
+			markets: []string{"BTC-PERP", "ETH-PERP"},
+			want:    []string{"a", "b", "d", "c"},
+		},
+		{
+			name:    "record of the page missing from the split",
+			recs:    []pageRec{{10, "a", "BTC-PERP"}, {9, "b", ""}, {9, "c", "BTC-PERP"}},
+			size:    2,
+			markets: allMarkets,
+			want:    []string{"a", "b"},
+			err:     errTruncatedPage,
+		},
+		{
+			name: "full second without split",
+			recs: []pageRec{{10, "a", ""}, {9, "b", ""}, {9, "c", ""}, {9, "d", ""}},
+			size: 2,
+			want: []string{"a", "b"},
+			err:  errTruncatedPage,
+		},
+		{
+			name:    "market fills a page of its second",
+			recs:    []pageRec{{9, "a", "BTC-PERP"}, {9, "b", "BTC-PERP"}, {9, "c", "ETH-PERP"}},
+			size:    2,
+			markets: allMarkets,
+			err:     errTruncatedPage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := loadState(filepath.Join(t.TempDir(), stateFile))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := exportPages(s, testPager(tt.recs, tt.size, tt.markets), 0)
+
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("emitted %v, want %v", got, tt.want)
+			}
+
+			if done := s.dataset("Main", "fills").Done; (done != nil) != (tt.err == nil) {
+				t.Errorf("Done = %+v with err %v", done, err)
+			}
+		})
+	}
+}
+
+// TestPaginateResume interrupts a walk after the first page and checks that
+// the next run writes every remaining record exactly once.
+func TestPaginateResume(t *testing.T) {
+	recs := []pageRec{{10, "a", ""}, {10, "b", ""}, {9, "c", ""}, {9, "d", ""}, {8, "e", ""}, {7, "f", ""}}
+	path := filepath.Join(t.TempDir(), stateFile)
+	s, err := loadState(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := exportPages(s, testPager(recs, 3, nil), 1)
+
+	if err == nil {
+		t.Fatal("first run was not interrupted")
+	}
+
+	if s, err = loadState(path); err != nil {
+		t.Fatal(err)
+	}
+
+	rest, err := exportPages(s, testPager(recs, 3, nil), 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := append(first, rest...), []string{"a", "b", "c", "d", "e", "f"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("emitted %v, want %v", got, want)
+	}
+}
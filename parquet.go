@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// parquetRowGroup is the number of rows buffered before a row group is
+	// written, it bounds the memory used for large histories.
+	parquetRowGroup = 64 * 1024
+
+	// Decimals are stored as DECIMAL(38, 18), digits beyond the 18th decimal
+	// place are rounded.
+	parquetScale     = 18
+	parquetPrecision = 38
+)
+
+// parquetSink writes every dataset of every account to a Parquet dataset
+// directory next to its CSV file, "Main_transaction_history.parquet/". Each run
+// adds a part file with the records it downloaded, the parts are removed
+// when the CSV file is started over.
+type parquetSink struct {
+	part string
+}
+
+func newParquetSink(started time.Time) *parquetSink {
+	return &parquetSink{part: fmt.Sprintf("part-%s.parquet", started.UTC().Format("20060102T150405Z"))}
+}
+
+func (s *parquetSink) open(job *exportJob, t *table) (tableWriter, error) {
+	dir := strings.TrimSuffix(job.outFile, filepath.Ext(job.outFile)) + ".parquet"
+
+	if job.restarted {
+		if err := os.RemoveAll(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	return &parquetWriter{path: filepath.Join(dir, s.part), table: t}, nil
+}
+
+func (s *parquetSink) close() error {
+	return nil
+}
+
+// parquetWriter creates its part file with the first rows, so runs without
+// new records add no empty parts. The file is written under a temporary name
+// that readers skip and renamed when it is complete.
+type parquetWriter struct {
+	path    string
+	table   *table
+	file    *os.File
+	writer  *parquet.Writer
+	columns []parquet.LeafColumn
+	rows    []parquet.Row
+}
+
+func (w *parquetWriter) write(rows [][]interface{}) error {
+	if w.writer == nil {
+		if err := w.create(); err != nil {
+			return err
+		}
+	}
+
+	w.rows = w.rows[:0]
+
+	for _, values := range rows {
+		row := make(parquet.Row, len(values))
+
+		for i, v := range values {
+			col := w.columns[i]
+			pv := parquetValue(v)
+
+			if pv.IsNull() {
+				row[col.ColumnIndex] = pv.Level(0, 0, col.ColumnIndex)
+			} else {
+				row[col.ColumnIndex] = pv.Level(0, col.MaxDefinitionLevel, col.ColumnIndex)
+			}
+		}
+
+		w.rows = append(w.rows, row)
+	}
+
+	_, err := w.writer.WriteRows(w.rows)
+	return err
+}
+
+func (w *parquetWriter) create() error {
+	group := parquet.Group{}
+
+	for _, c := range w.table.columns {
+		group[c.fieldName()] = parquetNode(c.kind)
+	}
+
+	schema := parquet.NewSchema(w.table.name, group)
+
+	for _, c := range w.table.columns {
+		col, _ := schema.Lookup(c.fieldName())
+		w.columns = append(w.columns, col)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(w.path), 0777); err != nil {
+		return err
+	}
+
+	file, err := os.Create(w.tmpPath())
+
+	if err != nil {
+		return err
+	}
+
+	w.file = file
+	w.writer = parquet.NewWriter(file,
+		schema,
+		parquet.MaxRowsPerRowGroup(parquetRowGroup),
+		parquet.Compression(&parquet.Snappy),
+		parquet.CreatedBy("ftx-export", version, ""),
+	)
+
+	return nil
+}
+
+func (w *parquetWriter) tmpPath() string {
+	return filepath.Join(filepath.Dir(w.path), "."+filepath.Base(w.path)+".tmp")
+}
+
+func (w *parquetWriter) close() error {
+	if w.writer == nil {
+		return nil
+	}
+
+	err := w.writer.Close()
+
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(w.tmpPath(), w.path)
+}
+
+func parquetNode(kind columnKind) parquet.Node {
+	switch kind {
+	case kindInt:
+		return parquet.Int(64)
+	case kindDecimal:
+		return parquet.Decimal(parquetScale, parquetPrecision, parquet.FixedLenByteArrayType(16))
+	case kindTime:
+		// Records without a time, like unconfirmed deposits, are null.
+		return parquet.Optional(parquet.Timestamp(parquet.Nanosecond))
+	case kindBool:
+		return parquet.Leaf(parquet.BooleanType)
+	}
+
+	return parquet.String()
+}
+
+func parquetValue(v interface{}) parquet.Value {
+	switch v := v.(type) {
+	case string:
+		return parquet.ByteArrayValue([]byte(v))
+	case int64:
+		return parquet.Int64Value(v)
+	case decimal.Decimal:
+		return parquet.FixedLenByteArrayValue(decimalBytes(v))
+	case time.Time:
+		if v.IsZero() {
+			return parquet.NullValue()
+		}
+
+		return parquet.Int64Value(v.UnixNano())
+	case bool:
+		return parquet.BooleanValue(v)
+	}
+
+	return parquet.NullValue()
+}
+
+// decimalBytes returns the unscaled value of d as 16 byte big-endian two's
+// complement.
+func decimalBytes(d decimal.Decimal) []byte {
+	unscaled := d.Shift(parquetScale).Round(0).BigInt()
+
+	if unscaled.Sign() < 0 {
+		// Two's complement of 128 bits.
+		unscaled.Add(unscaled, new(big.Int).Lsh(big.NewInt(1), 128))
+	}
+
+	buf := make([]byte, 16)
+	return unscaled.FillBytes(buf)
+}
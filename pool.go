@@ -0,0 +1,52 @@
+package main
+
+import "sync"
+
+// runPool calls work for every index in [0, n) on up to workers goroutines.
+// done is called once per index in ascending order, as soon as work has
+// returned for that index and all indexes before it, so anything reported
+// from done comes out in the same order however the work was scheduled. Calls
+// to done never overlap.
+func runPool(n, workers int, work func(i int), done func(i int)) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		finished = make([]bool, n)
+		next     = 0
+	)
+
+	queue := make(chan int)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range queue {
+				work(i)
+
+				mu.Lock()
+				finished[i] = true
+
+				for next < n && finished[next] {
+					done(next)
+					next++
+				}
+
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		queue <- i
+	}
+
+	close(queue)
+	wg.Wait()
+}
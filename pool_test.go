@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunPoolOrder(t *testing.T) {
+	for _, workers := range []int{0, 1, 3, 8} {
+		var order []int
+		var inDone int32
+
+		// Later indexes finish first.
+		runPool(10, workers, func(i int) {
+			time.Sleep(time.Duration(10-i) * time.Millisecond)
+		}, func(i int) {
+			if atomic.AddInt32(&inDone, 1) != 1 {
+				t.Error("done calls overlap")
+			}
+
+			order = append(order, i)
+			atomic.AddInt32(&inDone, -1)
+		})
+
+		if len(order) != 10 {
+			t.Fatalf("%d workers: done called %d times, want 10", workers, len(order))
+		}
+
+		for i, got := range order {
+			if got != i {
+				t.Fatalf("%d workers: done order %v, want ascending", workers, order)
+			}
+		}
+	}
+}
+
+// TestRunPoolAbort aborts the jobs after the first error the way export does,
+// by cancelling the context the remaining jobs run with. Every job is still
+// reported, in order.
+func TestRunPoolAbort(t *testing.T) {
+	const n, workers, failing = 20, 3, 4
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	failed := errors.New("authentication failed")
+	errs := make([]error, n)
+	var ran int32
+	var reported []int
+
+	runPool(n, workers, func(i int) {
+		// Later jobs start after the error and skip their work the way the
+		// API calls of export do.
+		if i > failing {
+			<-ctx.Done()
+			errs[i] = ctx.Err()
+			return
+		}
+
+		atomic.AddInt32(&ran, 1)
+
+		if i == failing {
+			errs[i] = failed
+			cancel()
+		}
+	}, func(i int) {
+		reported = append(reported, i)
+	})
+
+	for i, got := range reported {
+		if got != i {
+			t.Fatalf("done order %v, want ascending", reported)
+		}
+	}
+
+	if len(reported) != n || ran != failing+1 {
+		t.Fatalf("%d jobs reported and %d ran, want %d and %d", len(reported), ran, n, failing+1)
+	}
+
+	for i := failing + 1; i < n; i++ {
+		if !errors.Is(errs[i], context.Canceled) {
+			t.Errorf("errs[%d] = %v, want %v", i, errs[i], context.Canceled)
+		}
+	}
+}
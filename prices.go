@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/grishinsana/goftx"
+	"github.com/grishinsana/goftx/models"
+	"github.com/shopspring/decimal"
+)
+
+// priceCacheDir is the default price cache below the output directory.
+const priceCacheDir = "prices"
+
+// candleResolution is the resolution of the cached candles in seconds. A value
+// is the open of the candle that contains the event, the last price before it
+// and never one from after it.
+const candleResolution = models.Hour
+
+// priceMonth is one month of candles of a market, the unit the cache fetches
+// and stores.
+type priceMonth struct {
+	Market     string    `json:"market"`
+	Resolution int       `json:"resolution"`
+	FetchedAt  time.Time `json:"fetchedAt"`
+	// False for the current month, which is fetched again.
+	Complete bool `json:"complete"`
+	// The market does not exist.
+	Unavailable bool                      `json:"unavailable,omitempty"`
+	Candles     []*models.HistoricalPrice `json:"candles"`
+
+	byStart map[int64]*models.HistoricalPrice
+}
+
+// candle returns the candle starting at start.
+func (m *priceMonth) candle(start time.Time) *models.HistoricalPrice {
+	if m.byStart == nil {
+		m.byStart = make(map[int64]*models.HistoricalPrice, len(m.Candles))
+
+		for _, c := range m.Candles {
+			m.byStart[c.StartTime.Unix()] = c
+		}
+	}
+
+	return m.byStart[start.Unix()]
+}
+
+// priceCache values coins in USD from FTX candles. Candles are kept in a
+// directory, one file per market and month, so later runs and other commands
+// get the same values without network access.
+type priceCache struct {
+	dir    string
+	ctx    context.Context
+	client *goftx.Client
+	months map[string]*priceMonth
+	// First error of a lookup through priceFunc.
+	err error
+}
+
+// newPriceCache opens the cache in dir. Without a client the cache is used
+// offline and missing candles leave values unknown.
+func newPriceCache(ctx context.Context, dir string, client *goftx.Client) *priceCache {
+	return &priceCache{dir: dir, ctx: ctx, client: client, months: map[string]*priceMonth{}}
+}
+
+// openPriceCache opens the price cache of an export directory, cacheDir
+// defaults to prices/ inside it. Candles are only downloaded when online.
+func openPriceCache(dir, cacheDir string, offline bool) *priceCache {
+	if cacheDir == "" {
+		cacheDir = filepath.Join(dir, priceCacheDir)
+	}
+
+	var client *goftx.Client
+
+	if !offline {
+		// Candles are public, no credentials needed.
+		client = goftx.New()
+	}
+
+	return newPriceCache(context.Background(), cacheDir, client)
+}
+
+// usdPrice returns the USD price of a coin at t and where it came from. Coins
+// without a USD market are valued through their USDT market.
+func (c *priceCache) usdPrice(coin string, t time.Time) (decimal.Decimal, string, bool, error) {
+	if coin == "USD" {
+		return decimal.NewFromInt(1), "USD", true, nil
+	}
+
+	p, source, ok, err := c.candleOpen(coin+"/USD", t)
+
+	if err != nil || ok || coin == "USDT" {
+		return p, source, ok, err
+	}
+
+	p, source, ok, err = c.candleOpen(coin+"/USDT", t)
+
+	if err != nil || !ok {
+		return p, source, ok, err
+	}
+
+	usdt, usdtSource, ok, err := c.candleOpen("USDT/USD", t)
+
+	if err != nil || !ok {
+		return decimal.Zero, "", ok, err
+	}
+
+	return p.Mul(usdt), source + " x " + usdtSource, true, nil
+}
+
+// priceFunc returns the cache as priceFunc for the cost basis engine. Errors
+// make the price unknown and are kept in c.err.
+func (c *priceCache) priceFunc() priceFunc {
+	return func(coin string, t time.Time) (decimal.Decimal, bool) {
+		p, _, ok, err := c.usdPrice(coin, t)
+
+		if err != nil && c.err == nil {
+			c.err = err
+		}
+
+		return p, ok
+	}
+}
+
+// candleOpen returns the open of the candle of market containing t. The
+// source names the candle with its resolution.
+func (c *priceCache) candleOpen(market string, t time.Time) (decimal.Decimal, string, bool, error) {
+	month, err := c.month(market, t)
+
+	if err != nil || month.Unavailable {
+		return decimal.Zero, "", false, err
+	}
+
+	start := t.UTC().Truncate(time.Duration(candleResolution) * time.Second)
+	candle := month.candle(start)
+
+	if candle == nil {
+		return decimal.Zero, "", false, nil
+	}
+
+	source := fmt.Sprintf("FTX %s %ds candle %s open", market, int(candleResolution), start.Format(time.RFC3339))
+	return candle.Open, source, true, nil
+}
+
+// month returns the candles of the month of t, from memory, the cache
+// directory or the API.
+func (c *priceCache) month(market string, t time.Time) (*priceMonth, error) {
+	t = t.UTC()
+	from := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	key := market + "/" + from.Format("2006-01")
+
+	if m, ok := c.months[key]; ok {
+		return m, nil
+	}
+
+	path := filepath.Join(c.dir, strings.ReplaceAll(market, "/", "-"), from.Format("2006-01")+".json")
+	m, err := readPriceMonth(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if (m == nil || !m.Complete) && c.client != nil {
+		m, err = c.fetch(market, from)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err := writePriceMonth(path, m); err != nil {
+			return nil, err
+		}
+	}
+
+	if m == nil {
+		m = &priceMonth{Market: market, Unavailable: true}
+	}
+
+	c.months[key] = m
+	return m, nil
+}
+
+func (c *priceCache) fetch(market string, from time.Time) (*priceMonth, error) {
+	to := from.AddDate(0, 1, 0)
+	start := int(from.Unix())
+	end := int(to.Unix()) - 1
+	m := &priceMonth{
+		Market:     market,
+		Resolution: int(candleResolution),
+		FetchedAt:  time.Now().UTC(),
+		Complete:   time.Now().After(to),
+	}
+
+	// A month of hourly candles fits into one response.
+	candles, err := call(c.ctx, func() ([]*models.HistoricalPrice, error) {
+		return c.client.Markets.GetHistoricalPrices(market, &models.GetHistoricalPricesParams{
+			Resolution: candleResolution,
+			StartTime:  &start,
+			EndTime:    &end,
+		})
+	})
+
+	var apiErr *goftx.APIError
+
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		m.Unavailable = true
+		return m, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("candles of %s: %w", market, err)
+	}
+
+	m.Candles = candles
+	return m, nil
+}
+
+func readPriceMonth(path string) (*priceMonth, error) {
+	data, err := os.ReadFile(path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	m := &priceMonth{}
+
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return m, nil
+}
+
+func writePriceMonth(path string, m *priceMonth) error {
+	data, err := json.MarshalIndent(m, "", " ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+
+	if err := os.WriteFile(tmp, data, 0666); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
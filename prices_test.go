@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/grishinsana/goftx/models"
+)
+
+func TestUSDPrice(t *testing.T) {
+	dir := t.TempDir()
+	hour := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	month := &priceMonth{
+		Market:     "BTC/USD",
+		Resolution: int(candleResolution),
+		Complete:   true,
+		Candles: []*models.HistoricalPrice{
+			{StartTime: hour, Open: dec("40000"), Close: dec("41000")},
+			{StartTime: hour.Add(time.Hour), Open: dec("41000"), Close: dec("39000")},
+		},
+	}
+
+	if err := writePriceMonth(filepath.Join(dir, "BTC-USD", "2022-03.json"), month); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		coin   string
+		t      time.Time
+		price  string
+		source string
+		ok     bool
+	}{
+		{"start of the hour", "BTC", hour, "40000", "FTX BTC/USD 3600s candle 2022-03-01T10:00:00Z open", true},
+		{"end of the hour", "BTC", hour.Add(59 * time.Minute), "40000", "FTX BTC/USD 3600s candle 2022-03-01T10:00:00Z open", true},
+		{"next hour", "BTC", hour.Add(61 * time.Minute), "41000", "FTX BTC/USD 3600s candle 2022-03-01T11:00:00Z open", true},
+		{"no candle", "BTC", hour.Add(5 * time.Hour), "0", "", false},
+		{"USD", "USD", hour, "1", "USD", true},
+	}
+
+	prices := newPriceCache(context.Background(), dir, nil)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			price, source, ok, err := prices.usdPrice(tt.coin, tt.t)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if ok != tt.ok || !price.Equal(dec(tt.price)) || source != tt.source {
+				t.Errorf("usdPrice = %s, %q, %v, want %s, %q, %v", price, source, ok, tt.price, tt.source, tt.ok)
+			}
+		})
+	}
+}
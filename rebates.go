@@ -0,0 +1,131 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/kataras/golog"
+	"github.com/shopspring/decimal"
+)
+
+// rebateTotal sums the rebates of one referred subaccount in a month.
+type rebateTotal struct {
+	month      time.Time
+	subaccount string
+	days       int
+	total      decimal.Decimal
+}
+
+var rebateTotalsHeader = []string{"Month", "ReferredSubaccount", "Days", "Total"}
+
+// monthlyRebates sums the rebate records by month and referred subaccount,
+// oldest month first. Months are calendar months in UTC.
+func monthlyRebates(recs []record) []*rebateTotal {
+	type totalKey struct {
+		month      time.Time
+		subaccount string
+	}
+
+	byKey := map[totalKey]*rebateTotal{}
+	var totals []*rebateTotal
+
+	for _, r := range recs {
+		day := r.time("day").UTC()
+		k := totalKey{time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC), r.str("referred_subaccount")}
+		t := byKey[k]
+
+		if t == nil {
+			t = &rebateTotal{month: k.month, subaccount: k.subaccount}
+			byKey[k] = t
+			totals = append(totals, t)
+		}
+
+		t.days++
+		t.total = t.total.Add(r.dec("size"))
+	}
+
+	sort.Slice(totals, func(a, b int) bool {
+		if !totals[a].month.Equal(totals[b].month) {
+			return totals[a].month.Before(totals[b].month)
+		}
+
+		return totals[a].subaccount < totals[b].subaccount
+	})
+
+	return totals
+}
+
+// writeRebateTotals writes the monthly rebate totals of every account with
+// rebates, "Main_referral_rebates_monthly.csv". It returns the manifest items
+// of the written files.
+func writeRebateTotals(dir string, accounts []string) ([]*manifestItem, error) {
+	var items []*manifestItem
+
+	for _, account := range accounts {
+		recs, err := loadRecords(dir, account, "referral_rebates")
+
+		if err != nil {
+			return items, err
+		}
+
+		if len(recs) == 0 {
+			continue
+		}
+
+		totals := monthlyRebates(recs)
+		path := filepath.Join(dir, account+"_referral_rebates_monthly.csv")
+
+		if err := writeRebateTotalsFile(path, totals); err != nil {
+			return items, err
+		}
+
+		golog.Infof("Wrote %d monthly rebate totals for %s", len(totals), account)
+
+		item := &manifestItem{Path: filepath.Base(path), Subaccount: subAccountOf(account), Dataset: "referral_rebates_monthly"}
+
+		// Months are not timestamps, the file has no record time range.
+		if err := describeFile(path, "", item); err != nil {
+			return items, err
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+func writeRebateTotalsFile(path string, totals []*rebateTotal) error {
+	file, err := os.Create(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	csvWriter := outFormat.csvWriter(file)
+	csvWriter.Write(rebateTotalsHeader)
+
+	// Months are written as "2022-03" whatever the time format, a timestamp of
+	// the first of the month would shift to the previous day in zones west of
+	// UTC.
+	for _, t := range totals {
+		csvWriter.Write([]string{
+			t.month.Format("2006-01"),
+			t.subaccount,
+			strconv.Itoa(t.days),
+			outFormat.decimal(t.total),
+		})
+	}
+
+	csvWriter.Flush()
+
+	if err := csvWriter.Error(); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func rebate(day time.Time, subaccount, size string) record {
+	return record{"day": day, "referred_subaccount": subaccount, "size": dec(size)}
+}
+
+func TestMonthlyRebates(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		recs []record
+		// Month, subaccount, days and total of every row.
+		want []string
+	}{
+		{"no rebates", nil, nil},
+		{
+			name: "months and subaccounts",
+			recs: []record{
+				rebate(time.Date(2022, 4, 2, 0, 0, 0, 0, time.UTC), "bob", "1.5"),
+				rebate(time.Date(2022, 3, 31, 0, 0, 0, 0, time.UTC), "bob", "2"),
+				rebate(time.Date(2022, 3, 2, 0, 0, 0, 0, time.UTC), "alice", "0.25"),
+				rebate(time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC), "bob", "3"),
+			},
+			want: []string{"2022-03 alice 1 0.25", "2022-03 bob 2 5", "2022-04 bob 1 1.5"},
+		},
+		{
+			name: "months in UTC",
+			recs: []record{
+				// 2022-04-01 00:30 in Berlin is still March in UTC.
+				rebate(time.Date(2022, 4, 1, 0, 30, 0, 0, berlin), "bob", "1"),
+				rebate(time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC), "bob", "2"),
+			},
+			want: []string{"2022-03 bob 1 1", "2022-04 bob 1 2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+
+			for _, total := range monthlyRebates(tt.recs) {
+				got = append(got, strings.Join([]string{total.month.Format("2006-01"), total.subaccount, strconv.Itoa(total.days), total.total.String()}, " "))
+			}
+
+			if strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+				t.Errorf("totals = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestWriteRebateTotalsMonth checks that months do not move with the time
+// format.
+func TestWriteRebateTotalsMonth(t *testing.T) {
+	defer func(f *textFormat) { outFormat = f }(outFormat)
+
+	f, err := newTextFormat("rfc3339", "America/New_York", "", "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outFormat = f
+	path := filepath.Join(t.TempDir(), "Main_referral_rebates_monthly.csv")
+	totals := monthlyRebates([]record{rebate(time.Date(2022, 3, 5, 0, 0, 0, 0, time.UTC), "bob", "1")})
+
+	if err := writeRebateTotalsFile(path, totals); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "Month,ReferredSubaccount,Days,Total\n2022-03,bob,1,1\n"; string(data) != want {
+		t.Errorf("file = %q, want %q", data, want)
+	}
+}
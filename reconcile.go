@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/grishinsana/goftx"
+	"github.com/grishinsana/goftx/models"
+	"github.com/kataras/golog"
+	"github.com/shopspring/decimal"
+)
+
+// balanceChange is one change of a coin balance caused by an exported record.
+type balanceChange struct {
+	time   time.Time
+	coin   string
+	amount decimal.Decimal
+	source string
+}
+
+// replayBalances returns the balance changes of the exported history of an
+// account in time order, the amount and the fee of every ledger entry.
+// Futures only change the balance by their fees and funding, the settled PnL
+// is not part of the history.
+func replayBalances(dir, account string) ([]*balanceChange, error) {
+	entries, err := loadLedger(dir, account)
+
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]*balanceChange, 0, len(entries))
+
+	for _, e := range entries {
+		source := string(e.kind)
+
+		if e.reference != "" {
+			source += " " + e.reference
+		}
+
+		if delta := e.balanceDelta(); !delta.IsZero() {
+			changes = append(changes, &balanceChange{time: e.time, coin: e.coin, amount: delta, source: source})
+		}
+
+		// Negative fees are rebates and credit the balance.
+		if !e.feeAmount.IsZero() {
+			changes = append(changes, &balanceChange{time: e.time, coin: e.feeCoin, amount: e.feeAmount.Neg(), source: source + " fee"})
+		}
+	}
+
+	return changes, nil
+}
+
+// balancesOf sums the changes per coin.
+func balancesOf(changes []*balanceChange) map[string]decimal.Decimal {
+	balances := map[string]decimal.Decimal{}
+
+	for _, c := range changes {
+		balances[c.coin] = balances[c.coin].Add(c.amount)
+	}
+
+	return balances
+}
+
+// writeBalanceHistory writes the changes with the running balance of their
+// coin after each change.
+func writeBalanceHistory(path string, changes []*balanceChange) error {
+	file, err := os.Create(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	csvWriter := outFormat.csvWriter(file)
+	csvWriter.Write([]string{"Time", "Coin", "Change", "Balance", "Source"})
+	balances := map[string]decimal.Decimal{}
+
+	for _, c := range changes {
+		balances[c.coin] = balances[c.coin].Add(c.amount)
+		csvWriter.Write([]string{outFormat.time(c.time), c.coin, outFormat.decimal(c.amount), outFormat.decimal(balances[c.coin]), c.source})
+	}
+
+	csvWriter.Flush()
+
+	if err := csvWriter.Error(); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+// balanceGap compares the replayed balance of a coin with the wallet.
+type balanceGap struct {
+	account  string
+	coin     string
+	replayed decimal.Decimal
+	actual   decimal.Decimal
+}
+
+func (g *balanceGap) difference() decimal.Decimal {
+	return g.actual.Sub(g.replayed)
+}
+
+// walletBalances returns the current total of every coin of an account.
+func walletBalances(ctx context.Context, client *goftx.Client, account string) (map[string]decimal.Decimal, error) {
+	var balances []*models.Balance
+	var err error
+
+	if subAcc := subAccountOf(account); subAcc == "" {
+		balances, err = call(ctx, client.GetBalances)
+	} else {
+		balances, err = call(ctx, func() ([]*models.Balance, error) {
+			return client.GetSubaccountBalances(subAcc)
+		})
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("balances of %s: %w", account, err)
+	}
+
+	totals := make(map[string]decimal.Decimal, len(balances))
+
+	for _, b := range balances {
+		totals[b.Coin] = b.Total
+	}
+
+	return totals, nil
+}
+
+// reconcileDir replays the history of every account exported to dir, writes
+// the balance history of each account and compares the balances with the
+// wallets. It returns the number of coins whose gap exceeds tolerance.
+func reconcileDir(ctx context.Context, dir string, client *goftx.Client, tolerance decimal.Decimal) (int, []*manifestItem, error) {
+	accounts, err := exportedAccounts(dir)
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if len(accounts) == 0 {
+		return 0, nil, fmt.Errorf("no exported accounts found in %s", dir)
+	}
+
+	var gaps []*balanceGap
+	var items []*manifestItem
+
+	for _, account := range accounts {
+		changes, err := replayBalances(dir, account)
+
+		if err != nil {
+			return 0, items, err
+		}
+
+		path := filepath.Join(dir, account+"_balance_history.csv")
+
+		if err := writeBalanceHistory(path, changes); err != nil {
+			return 0, items, err
+		}
+
+		items = append(items, &manifestItem{Path: filepath.Base(path), Subaccount: subAccountOf(account), Dataset: "balance_history"})
+
+		actual, err := walletBalances(ctx, client, account)
+
+		if err != nil {
+			return 0, items, err
+		}
+
+		replayed := balancesOf(changes)
+		coins := make([]string, 0, len(replayed)+len(actual))
+
+		for coin := range replayed {
+			coins = append(coins, coin)
+		}
+
+		for coin := range actual {
+			if _, ok := replayed[coin]; !ok {
+				coins = append(coins, coin)
+			}
+		}
+
+		sort.Strings(coins)
+
+		for _, coin := range coins {
+			if replayed[coin].IsZero() && actual[coin].IsZero() {
+				continue
+			}
+
+			gaps = append(gaps, &balanceGap{account: account, coin: coin, replayed: replayed[coin], actual: actual[coin]})
+		}
+	}
+
+	path := filepath.Join(dir, "reconciliation.csv")
+	mismatches, err := writeReconciliation(path, gaps, tolerance)
+
+	if err != nil {
+		return 0, items, err
+	}
+
+	items = append(items, &manifestItem{Path: filepath.Base(path), Dataset: "reconciliation"})
+	return mismatches, items, nil
+}
+
+// writeReconciliation writes one row per account and coin, logs the coins
+// that do not match and returns their number.
+func writeReconciliation(path string, gaps []*balanceGap, tolerance decimal.Decimal) (int, error) {
+	file, err := os.Create(path)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer file.Close()
+
+	csvWriter := outFormat.csvWriter(file)
+	csvWriter.Write([]string{"Subaccount", "Coin", "Replayed", "Wallet", "Difference", "Status"})
+	mismatches := 0
+
+	for _, g := range gaps {
+		status := "ok"
+
+		if g.difference().Abs().GreaterThan(tolerance) {
+			status = "mismatch"
+			mismatches++
+			golog.Warnf("%s %s: history gives %s, wallet holds %s, gap %s", g.account, g.coin, g.replayed, g.actual, g.difference())
+		}
+
+		csvWriter.Write([]string{subAccountOf(g.account), g.coin, outFormat.decimal(g.replayed), outFormat.decimal(g.actual), outFormat.decimal(g.difference()), status})
+	}
+
+	csvWriter.Flush()
+
+	if err := csvWriter.Error(); err != nil {
+		return mismatches, err
+	}
+
+	return mismatches, file.Close()
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/grishinsana/goftx"
+	"github.com/kataras/golog"
+)
+
+type errorClass int
+
+const (
+	errUnknown errorClass = iota
+	errRateLimited
+	errTransient
+	errAuth
+	errPermission
+	errBadRequest
+)
+
+func (c errorClass) String() string {
+	switch c {
+	case errRateLimited:
+		return "rate limited"
+	case errTransient:
+		return "transient error"
+	case errAuth:
+		return "authentication failed"
+	case errPermission:
+		return "permission denied"
+	case errBadRequest:
+		return "bad request"
+	}
+
+	return "error"
+}
+
+func (c errorClass) retryable() bool {
+	return c == errRateLimited || c == errTransient
+}
+
+// Backoff of retried requests. maxRetries is set by the -retries flag.
+var (
+	maxRetries   = 6
+	retryBackoff = 500 * time.Millisecond
+	maxBackoff   = 30 * time.Second
+)
+
+// classify sorts an error returned by the goftx client into the classes that
+// decide whether a request is retried or the export is aborted.
+func classify(err error) errorClass {
+	var apiErr *goftx.APIError
+
+	if errors.As(err, &apiErr) {
+		msg := strings.ToLower(apiErr.Message)
+
+		switch {
+		case apiErr.StatusCode == http.StatusTooManyRequests || strings.Contains(msg, "do not send more than"):
+			return errRateLimited
+		case apiErr.StatusCode >= http.StatusInternalServerError:
+			return errTransient
+		case apiErr.StatusCode == http.StatusUnauthorized || strings.Contains(msg, "not logged in") || strings.Contains(msg, "invalid api key"):
+			return errAuth
+		case apiErr.StatusCode == http.StatusForbidden:
+			return errPermission
+		case apiErr.StatusCode >= http.StatusBadRequest:
+			return errBadRequest
+		}
+
+		return errUnknown
+	}
+
+	var netErr net.Error
+
+	if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return errTransient
+	}
+
+	return errUnknown
+}
+
+// authError aborts the whole export, the credentials are the same for every
+// account so there is no point in going on.
+type authError struct {
+	err error
+}
+
+func (e *authError) Error() string {
+	return fmt.Sprintf("authentication failed, check the API key and secret: %v", e.err)
+}
+
+func (e *authError) Unwrap() error {
+	return e.err
+}
+
+// call runs an API request under the rate limit. Rate limited and transient
+// errors are retried with jittered exponential backoff.
+func call[T any](ctx context.Context, fn func() (T, error)) (T, error) {
+	var zero T
+
+	for attempt := 1; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return zero, err
+		}
+
+		limiter.Wait()
+		res, err := fn()
+
+		if err == nil {
+			return res, nil
+		}
+
+		class := classify(err)
+
+		if class == errAuth {
+			return zero, &authError{err}
+		}
+
+		if !class.retryable() || attempt > maxRetries {
+			return zero, err
+		}
+
+		backoff := retryBackoff << (attempt - 1)
+
+		if backoff > maxBackoff || backoff <= 0 {
+			backoff = maxBackoff
+		}
+
+		// Full jitter keeps concurrent workers from retrying in lockstep.
+		backoff = time.Duration(rand.Int63n(int64(backoff))) + retryBackoff/2
+
+		golog.Warnf("%s, retrying in %s (%d/%d): %v", class, backoff.Round(time.Millisecond), attempt, maxRetries, err)
+
+		select {
+		case <-ctx.Done():
+			return zero, ctx.Err()
+		case <-time.After(backoff):
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/grishinsana/goftx"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want errorClass
+	}{
+		{"too many requests", &goftx.APIError{StatusCode: 429}, errRateLimited},
+		{"rate limit message", &goftx.APIError{StatusCode: 400, Message: "Do not send more than 30 requests per second"}, errRateLimited},
+		{"server error", &goftx.APIError{StatusCode: 503}, errTransient},
+		{"unauthorized", &goftx.APIError{StatusCode: 401}, errAuth},
+		{"not logged in", &goftx.APIError{StatusCode: 400, Message: "Not logged in"}, errAuth},
+		{"invalid key", &goftx.APIError{StatusCode: 400, Message: "Invalid API key"}, errAuth},
+		{"forbidden", &goftx.APIError{StatusCode: 403}, errPermission},
+		{"bad request", &goftx.APIError{StatusCode: 400, Message: "No such market"}, errBadRequest},
+		{"wrapped", fmt.Errorf("fills: %w", &goftx.APIError{StatusCode: 502}), errTransient},
+		{"other status", &goftx.APIError{StatusCode: 302}, errUnknown},
+		{"network", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, errTransient},
+		{"unexpected eof", io.ErrUnexpectedEOF, errTransient},
+		{"other", errors.New("decode"), errUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classify(tt.err); got != tt.want {
+				t.Errorf("classify(%v) = %s, want %s", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCall(t *testing.T) {
+	defer func(retries int, backoff time.Duration) {
+		maxRetries, retryBackoff = retries, backoff
+	}(maxRetries, retryBackoff)
+
+	maxRetries, retryBackoff = 2, time.Millisecond
+	transient := &goftx.APIError{StatusCode: 500}
+	badRequest := &goftx.APIError{StatusCode: 400}
+	auth := &goftx.APIError{StatusCode: 401}
+
+	tests := []struct {
+		name     string
+		errs     []error
+		attempts int
+		err      error
+	}{
+		{"success", nil, 1, nil},
+		{"retried until success", []error{transient, transient}, 3, nil},
+		{"retries exhausted", []error{transient, transient, transient, transient}, 3, transient},
+		{"bad request not retried", []error{badRequest}, 1, badRequest},
+		{"auth aborts", []error{auth}, 1, auth},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+
+			res, err := call(context.Background(), func() (int, error) {
+				attempts++
+
+				if attempts <= len(tt.errs) {
+					return 0, tt.errs[attempts-1]
+				}
+
+				return 42, nil
+			})
+
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+
+			if attempts != tt.attempts {
+				t.Errorf("%d attempts, want %d", attempts, tt.attempts)
+			}
+
+			if tt.err == nil && res != 42 {
+				t.Errorf("result = %d, want 42", res)
+			}
+		})
+	}
+
+	var authErr *authError
+
+	if _, err := call(context.Background(), func() (int, error) { return 0, auth }); !errors.As(err, &authErr) {
+		t.Errorf("err = %v, want an authError", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := call(ctx, func() (int, error) { return 0, nil }); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want %v", err, context.Canceled)
+	}
+}
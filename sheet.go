@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/shopspring/decimal"
+	"github.com/xuri/excelize/v2"
+)
+
+// readSheet reads the rows of a CSV file or of the first sheet of an XLSX
+// workbook.
+func readSheet(path string) ([][]string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".xlsx", ".xlsm":
+		book, err := excelize.OpenFile(path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer book.Close()
+
+		rows, err := book.GetRows(book.GetSheetName(0))
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		return rows, nil
+	}
+
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	csvReader := csv.NewReader(file)
+	csvReader.FieldsPerRecord = -1
+	csvReader.LazyQuotes = true
+	rows, err := csvReader.ReadAll()
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return rows, nil
+}
+
+// columnMatcher recognizes a column by its lower case name.
+type columnMatcher func(name string) bool
+
+// findHeader returns the first row that has a column for every matcher and
+// the index of each. Title rows above the header are skipped.
+func findHeader(rows [][]string, matchers ...columnMatcher) (int, []int, bool) {
+	for r, row := range rows {
+		cols := make([]int, len(matchers))
+		found := 0
+
+		for m := range cols {
+			cols[m] = -1
+		}
+
+		for i, name := range row {
+			name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+
+			for m, match := range matchers {
+				if cols[m] < 0 && match(name) {
+					cols[m] = i
+					found++
+					break
+				}
+			}
+		}
+
+		if found == len(matchers) {
+			return r, cols, true
+		}
+	}
+
+	return 0, nil, false
+}
+
+// isCoinColumn recognizes the usual names of a coin column.
+func isCoinColumn(name string) bool {
+	switch name {
+	case "coin", "token", "asset", "symbol", "ticker", "currency":
+		return true
+	}
+
+	return false
+}
+
+// cell returns a trimmed cell of a row, rows of sheets can be shorter than
+// their header.
+func cell(row []string, i int) string {
+	if i < 0 || i >= len(row) {
+		return ""
+	}
+
+	return strings.TrimSpace(row[i])
+}
+
+// parseAmount reads numbers as spreadsheets write them, with dollar signs,
+// thousands separators and negative numbers in parentheses.
+func parseAmount(s string) (decimal.Decimal, error) {
+	s = strings.NewReplacer("$", "", ",", "", " ", "").Replace(s)
+	negative := strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")")
+
+	if negative {
+		s = s[1 : len(s)-1]
+	}
+
+	d, err := decimal.NewFromString(s)
+
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	if negative {
+		d = d.Neg()
+	}
+
+	return d, nil
+}
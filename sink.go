@@ -0,0 +1,95 @@
+package main
+
+import "time"
+
+// sink is an output that receives the records of every dataset in addition to
+// the CSV files, for example a database.
+type sink interface {
+	// open starts writing the rows of one dataset of the job's account.
+	open(job *exportJob, t *table) (tableWriter, error)
+	close() error
+}
+
+// tableWriter receives the rows of one dataset, newest first. Rows that were
+// written by an earlier run may be written again.
+type tableWriter interface {
+	write(rows [][]interface{}) error
+	close() error
+}
+
+// tableWriters fans the rows of a job out to all sinks.
+type tableWriters []tableWriter
+
+func (j *exportJob) openSinks(t *table) (tableWriters, error) {
+	writers := make(tableWriters, 0, len(j.sinks))
+
+	for _, s := range j.sinks {
+		w, err := s.open(j, t)
+
+		if err != nil {
+			writers.close()
+			return nil, err
+		}
+
+		writers = append(writers, w)
+	}
+
+	return writers, nil
+}
+
+func (ws tableWriters) write(rows [][]interface{}) error {
+	for _, w := range ws {
+		if err := w.write(rows); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ws tableWriters) close() error {
+	var first error
+
+	for _, w := range ws {
+		if err := w.close(); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
+
+// openSinks opens the outputs selected in the options.
+func openSinks(opts *exportOptions) ([]sink, error) {
+	var sinks []sink
+
+	if opts.sqlite != "" {
+		s, err := openSQLite(opts.sqlite)
+
+		if err != nil {
+			return nil, err
+		}
+
+		sinks = append(sinks, s)
+	}
+
+	if opts.parquet {
+		sinks = append(sinks, newParquetSink(time.Now()))
+	}
+
+	return sinks, nil
+}
+
+// closeSinks closes every sink once all datasets are written and returns the
+// first error.
+func closeSinks(sinks []sink) error {
+	var first error
+
+	for _, s := range sinks {
+		if err := s.close(); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
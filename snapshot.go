@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kataras/golog"
+	"github.com/shopspring/decimal"
+)
+
+// petitionDate is the day FTX filed for bankruptcy, the date claims are
+// valued at.
+var petitionDate = time.Date(2022, 11, 11, 0, 0, 0, 0, time.UTC)
+
+// parseSnapshotTime accepts a date, which means the start of the day in UTC,
+// or an RFC 3339 timestamp.
+func parseSnapshotTime(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, use 2006-01-02 or RFC 3339", s)
+	}
+
+	return t.UTC(), nil
+}
+
+// snapshotFile is the default name of the schedule of the holdings at t.
+func snapshotFile(t time.Time) string {
+	if t.Equal(t.Truncate(24 * time.Hour)) {
+		return "balance_snapshot_" + t.Format("2006-01-02") + ".csv"
+	}
+
+	return "balance_snapshot_" + t.Format("20060102T150405Z") + ".csv"
+}
+
+// holding is the balance of a coin in an account at the snapshot time.
+type holding struct {
+	account string
+	coin    string
+	balance decimal.Decimal
+}
+
+// holdingsAt rebuilds the balances of the accounts from the records before at.
+func holdingsAt(dir string, accounts []string, at time.Time) ([]*holding, error) {
+	var holdings []*holding
+
+	for _, account := range accounts {
+		changes, err := replayBalances(dir, account)
+
+		if err != nil {
+			return nil, err
+		}
+
+		n := sort.Search(len(changes), func(i int) bool {
+			return !changes[i].time.Before(at)
+		})
+
+		balances := balancesOf(changes[:n])
+		coins := make([]string, 0, len(balances))
+
+		for coin, b := range balances {
+			if !b.IsZero() {
+				coins = append(coins, coin)
+			}
+		}
+
+		sort.Strings(coins)
+
+		for _, coin := range coins {
+			holdings = append(holdings, &holding{account: account, coin: coin, balance: balances[coin]})
+		}
+	}
+
+	return holdings, nil
+}
+
+// loadPriceTable reads USD prices per coin from a CSV file or XLSX workbook
+// with a header. The coin column is called Coin, Token, Asset or Symbol, the
+// price column is the first one with "price" in its name. Dollar signs and
+// thousands separators are ignored, so the tables published by the debtors
+// can be used as they are.
+func loadPriceTable(path string) (map[string]decimal.Decimal, error) {
+	rows, err := readSheet(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	h, cols, ok := findHeader(rows, isCoinColumn, func(name string) bool {
+		return strings.Contains(name, "price")
+	})
+
+	if !ok {
+		return nil, fmt.Errorf("%s: price table needs a coin and a price column", path)
+	}
+
+	prices := map[string]decimal.Decimal{}
+
+	for i, row := range rows[h+1:] {
+		coin, raw := strings.ToUpper(cell(row, cols[0])), cell(row, cols[1])
+
+		if coin == "" || raw == "" {
+			continue
+		}
+
+		price, err := parseAmount(raw)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: row %d: invalid price %q of %s", path, h+i+2, raw, coin)
+		}
+
+		prices[coin] = price
+	}
+
+	return prices, nil
+}
+
+// writeSnapshot writes the schedule of holdings, valued when prices are
+// given. Coins without a price keep empty value columns.
+func writeSnapshot(path string, at time.Time, holdings []*holding, prices map[string]decimal.Decimal) error {
+	file, err := os.Create(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	csvWriter := outFormat.csvWriter(file)
+	csvWriter.Write([]string{"Subaccount", "Coin", "Balance", "AsOf", "PriceUSD", "ValueUSD"})
+	total := decimal.Zero
+	var unpriced []string
+	seen := map[string]bool{}
+
+	for _, h := range holdings {
+		price, ok := prices[h.coin]
+
+		if !ok && h.coin == "USD" {
+			price, ok = decimal.NewFromInt(1), true
+		}
+
+		priceStr, valueStr := "", ""
+
+		if ok {
+			value := h.balance.Mul(price)
+			total = total.Add(value)
+			priceStr, valueStr = outFormat.decimal(price), outFormat.fixed(value, 2)
+		} else if prices != nil && !seen[h.coin] {
+			seen[h.coin] = true
+			unpriced = append(unpriced, h.coin)
+		}
+
+		csvWriter.Write([]string{subAccountOf(h.account), h.coin, outFormat.decimal(h.balance), outFormat.time(at), priceStr, valueStr})
+	}
+
+	csvWriter.Flush()
+
+	if err := csvWriter.Error(); err != nil {
+		return err
+	}
+
+	if prices != nil {
+		golog.Infof("Wrote %d holdings worth %s USD as of %s to %s", len(holdings), total.StringFixed(2), at, path)
+	} else {
+		golog.Infof("Wrote %d holdings as of %s to %s", len(holdings), at, path)
+	}
+
+	if len(unpriced) > 0 {
+		golog.Warnf("No price for %s", strings.Join(unpriced, ", "))
+	}
+
+	return file.Close()
+}
+
+// snapshotReport writes the holdings of all accounts exported to dir at the
+// time at. priceFile is optional.
+func snapshotReport(dir, out string, at time.Time, priceFile string) error {
+	accounts, err := exportedAccounts(dir)
+
+	if err != nil {
+		return err
+	}
+
+	if len(accounts) == 0 {
+		return fmt.Errorf("no exported accounts found in %s", dir)
+	}
+
+	var prices map[string]decimal.Decimal
+
+	if priceFile != "" {
+		if prices, err = loadPriceTable(priceFile); err != nil {
+			return err
+		}
+	}
+
+	holdings, err := holdingsAt(dir, accounts, at)
+
+	if err != nil {
+		return err
+	}
+
+	if err := writeSnapshot(out, at, holdings, prices); err != nil {
+		return err
+	}
+
+	return addReportToManifest(dir, out, "balance_snapshot")
+}
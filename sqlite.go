@@ -0,0 +1,182 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	_ "github.com/ncruces/go-sqlite3/driver"
+	_ "github.com/ncruces/go-sqlite3/embed"
+)
+
+// sqliteTimeLayout sorts as text and is understood by the SQLite date
+// functions.
+const sqliteTimeLayout = "2006-01-02 15:04:05.000000"
+
+// sqliteSink writes all datasets of all accounts into one SQLite database,
+// one table per dataset with a subaccount column. Records are upserted by
+// their primary key, so a database can be updated by every run.
+type sqliteSink struct {
+	db *sql.DB
+
+	mu      sync.Mutex
+	created map[string]bool
+}
+
+func openSQLite(path string) (*sqliteSink, error) {
+	db, err := sql.Open("sqlite3", "file:"+path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite has a single writer, the workers take turns on one connection.
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return &sqliteSink{db: db, created: map[string]bool{}}, nil
+}
+
+func (s *sqliteSink) open(job *exportJob, t *table) (tableWriter, error) {
+	if err := s.create(t); err != nil {
+		return nil, err
+	}
+
+	return &sqliteWriter{db: s.db, account: job.account, upsert: upsertStatement(t), columns: t.columns}, nil
+}
+
+func (s *sqliteSink) close() error {
+	return s.db.Close()
+}
+
+// create adds the table of a dataset and its indexes unless they exist.
+func (s *sqliteSink) create(t *table) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.created[t.name] {
+		return nil
+	}
+
+	defs := []string{"subaccount TEXT NOT NULL"}
+
+	for _, c := range t.columns {
+		defs = append(defs, fmt.Sprintf("%s %s", c.fieldName(), sqliteType(c.kind)))
+	}
+
+	defs = append(defs, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(t.primaryKey, ", ")))
+	stmts := []string{fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n  %s\n)", t.name, strings.Join(defs, ",\n  "))}
+
+	for _, field := range append([]string{"subaccount"}, t.indexes...) {
+		stmts = append(stmts, fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_%s ON %s (%s)", t.name, field, t.name, field))
+	}
+
+	for _, stmt := range stmts {
+		if _, err := s.db.Exec(stmt); err != nil {
+			return fmt.Errorf("creating table %s: %w", t.name, err)
+		}
+	}
+
+	s.created[t.name] = true
+	return nil
+}
+
+func sqliteType(kind columnKind) string {
+	switch kind {
+	case kindInt, kindBool:
+		return "INTEGER"
+	case kindDecimal:
+		// NUMERIC would turn most decimals into lossy floats, text keeps every
+		// digit. Arithmetic needs CAST(column AS REAL).
+		return "TEXT"
+	}
+
+	return "TEXT"
+}
+
+// upsertStatement inserts a row or updates all columns of the row with the
+// same primary key.
+func upsertStatement(t *table) string {
+	fields := []string{"subaccount"}
+	params := []string{"?"}
+	var updates []string
+
+	for _, c := range t.columns {
+		fields = append(fields, c.fieldName())
+		params = append(params, "?")
+		updates = append(updates, fmt.Sprintf("%s = excluded.%s", c.fieldName(), c.fieldName()))
+	}
+
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (%s) DO UPDATE SET %s",
+		t.name, strings.Join(fields, ", "), strings.Join(params, ", "), strings.Join(t.primaryKey, ", "), strings.Join(updates, ", "))
+}
+
+type sqliteWriter struct {
+	db      *sql.DB
+	account string
+	upsert  string
+	columns []column
+}
+
+// write upserts the rows in one transaction.
+func (w *sqliteWriter) write(rows [][]interface{}) error {
+	tx, err := w.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(w.upsert)
+
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	defer stmt.Close()
+
+	for _, row := range rows {
+		args := make([]interface{}, 0, len(row)+1)
+		args = append(args, w.account)
+
+		for _, v := range row {
+			args = append(args, sqliteValue(v))
+		}
+
+		if _, err := stmt.Exec(args...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (w *sqliteWriter) close() error {
+	return nil
+}
+
+// sqliteValue converts a value for binding. Decimals are stored as their
+// exact text, zero times become NULL.
+func sqliteValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case decimal.Decimal:
+		return v.String()
+	case time.Time:
+		if v.IsZero() {
+			return nil
+		}
+
+		return v.UTC().Format(sqliteTimeLayout)
+	}
+
+	return v
+}
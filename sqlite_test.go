@@ -0,0 +1,72 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSQLiteRoundTrip(t *testing.T) {
+	s, err := openSQLite(filepath.Join(t.TempDir(), "ftx.sqlite"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer s.close()
+
+	tbl := &table{
+		name: "amounts",
+		columns: []column{
+			{name: "ID", kind: kindInt},
+			{name: "Size", kind: kindDecimal},
+			{name: "Time", kind: kindTime},
+		},
+		primaryKey: []string{"id"},
+	}
+
+	values := []string{"0.000000012345678901234", "123456789012345678.123456789", "-0.1", "0", "100"}
+	var rows [][]interface{}
+
+	for i, v := range values {
+		rows = append(rows, []interface{}{int64(i), dec(v), at(i)})
+	}
+
+	w, err := s.open(&exportJob{account: "Main"}, tbl)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.write(rows); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range values {
+		var subaccount, size, tm string
+
+		if err := s.db.QueryRow("SELECT subaccount, size, time FROM amounts WHERE id = ?", i).Scan(&subaccount, &size, &tm); err != nil {
+			t.Fatal(err)
+		}
+
+		if size != want || subaccount != "Main" || tm != at(i).Format(sqliteTimeLayout) {
+			t.Errorf("row %d = %s, %s, %s, want Main, %s, %s", i, subaccount, size, tm, want, at(i).Format(sqliteTimeLayout))
+		}
+	}
+
+	// Upserting a row again replaces it.
+	if err := w.write([][]interface{}{{int64(0), dec("0.5"), time.Time{}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	var size string
+
+	if err := s.db.QueryRow("SELECT COUNT(*), MAX(CASE WHEN id = 0 THEN size END) FROM amounts").Scan(&n, &size); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != len(values) || size != "0.5" {
+		t.Errorf("after upsert %d rows with size %s, want %d and 0.5", n, size, len(values))
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/grishinsana/goftx"
+	"github.com/grishinsana/goftx/models"
+)
+
+// Staking rewards are paid in the staked coin, SRM, FTT or SOL, or in the
+// coin of the staking program.
+var stakingRewardsDataset = &csvDataset[*models.StakingReward]{
+	endpoints: []string{"/staking/staking_rewards"},
+	columns: &table{
+		name: "staking_rewards",
+		columns: []column{
+			{name: "Coin", kind: kindString},
+			{name: "ID", kind: kindInt},
+			{name: "Size", kind: kindDecimal},
+			{name: "Status", kind: kindString},
+			{name: "Time", kind: kindTime},
+		},
+		primaryKey: []string{"id"},
+		indexes:    []string{"time", "coin"},
+	},
+	fetch: func(client *goftx.Client, _ *exportFilter) pageFunc[*models.StakingReward] {
+		return client.Staking.GetStakingRewards
+	},
+	pageSize: ftxPageSize,
+	key: func(r *models.StakingReward) (time.Time, string) {
+		return r.Time, strconv.FormatInt(r.ID, 10)
+	},
+	subject: func(r *models.StakingReward) ([]string, string) {
+		return []string{r.Coin}, ""
+	},
+	values: func(r *models.StakingReward) []interface{} {
+		return []interface{}{
+			r.Coin,
+			r.ID,
+			r.Size,
+			r.Status,
+			r.Time,
+		}
+	},
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const stateFile = ".ftx-export-state.json"
+
+// checkpoint marks a position in the history of a dataset. Records that share
+// the timestamp of the checkpoint are told apart by their IDs.
+type checkpoint struct {
+	Time time.Time `json:"time"`
+	IDs  []string  `json:"ids"`
+}
+
+func (c *checkpoint) has(t time.Time, id string) bool {
+	if c == nil || !t.Equal(c.Time) {
+		return false
+	}
+
+	for _, v := range c.IDs {
+		if v == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// datasetState is the persisted progress of one dataset of one account.
+type datasetState struct {
+	// Newest record written by the last completed run.
+	Done *checkpoint `json:"done,omitempty"`
+	// Set while a run is in progress so it can be resumed after an interruption.
+	Pending *pendingState `json:"pending,omitempty"`
+}
+
+// pendingState describes a run that walks backwards from the newest record
+// down to Done.
+type pendingState struct {
+	// Oldest record written so far.
+	Cursor *checkpoint `json:"cursor"`
+	// Newest record written so far.
+	Newest *checkpoint `json:"newest"`
+}
+
+// exportState is shared by all workers of an export, access to the datasets
+// is guarded by mu.
+type exportState struct {
+	path     string
+	mu       sync.Mutex
+	Accounts map[string]map[string]*datasetState `json:"accounts"`
+	// Filter of the runs that wrote the files, nil for complete exports.
+	Filter *exportFilter `json:"filter,omitempty"`
+}
+
+func loadState(path string) (*exportState, error) {
+	s := &exportState{
+		path:     path,
+		Accounts: map[string]map[string]*datasetState{},
+	}
+
+	data, err := os.ReadFile(path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// save writes the state to a temporary file first so an interruption never
+// leaves a truncated state file behind.
+func (s *exportState) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.MarshalIndent(s, "", " ")
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(filepath.Dir(s.path), "."+filepath.Base(s.path)+".tmp")
+
+	if err := os.WriteFile(tmp, data, 0666); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path)
+}
+
+func (s *exportState) dataset(account, dataset string) *datasetState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc, ok := s.Accounts[account]
+	if !ok {
+		acc = map[string]*datasetState{}
+		s.Accounts[account] = acc
+	}
+
+	ds, ok := acc[dataset]
+	if !ok {
+		ds = &datasetState{}
+		acc[dataset] = ds
+	}
+
+	return ds
+}
+
+func (s *exportState) reset(account, dataset string) {
+	ds := s.dataset(account, dataset)
+
+	s.mu.Lock()
+	*ds = datasetState{}
+	s.mu.Unlock()
+}
+
+// window is the time range a run still has to download for a dataset.
+// Records are expected newest first.
+type window struct {
+	state   *exportState
+	ds      *datasetState
+	resumed bool
+	// Exclusive lower bound, nil when the dataset was never downloaded.
+	since *checkpoint
+	// Lower bound of the filter, zero when unbounded.
+	from  time.Time
+	until time.Time
+}
+
+// start returns the lower bound of the window, the epoch for a first run.
+func (w *window) start() time.Time {
+	start := time.Unix(0, 0)
+
+	if w.since != nil {
+		start = w.since.Time
+	}
+
+	if w.from.After(start) {
+		return w.from
+	}
+
+	return start
+}
+
+// written reports whether a record has already been written by this or a
+// previous run.
+func (w *window) written(t time.Time, id string) bool {
+	if w.since != nil && (t.Before(w.since.Time) || w.since.has(t, id)) {
+		return true
+	}
+
+	// Runs walk backwards in time, so everything newer than the cursor has
+	// already been handled.
+	cursor := w.ds.Pending.Cursor
+
+	return cursor != nil && (t.After(cursor.Time) || cursor.has(t, id))
+}
+
+// add records that a record has been written.
+func (w *window) add(t time.Time, id string) {
+	w.state.mu.Lock()
+	defer w.state.mu.Unlock()
+
+	p := w.ds.Pending
+
+	switch {
+	case p.Cursor == nil || t.Before(p.Cursor.Time):
+		p.Cursor = &checkpoint{Time: t, IDs: []string{id}}
+	case t.Equal(p.Cursor.Time):
+		p.Cursor.IDs = append(p.Cursor.IDs, id)
+	}
+
+	switch {
+	case p.Newest == nil || t.After(p.Newest.Time):
+		p.Newest = &checkpoint{Time: t, IDs: []string{id}}
+	case t.Equal(p.Newest.Time):
+		p.Newest.IDs = append(p.Newest.IDs, id)
+	}
+}
+
+// save persists the progress. Output must be flushed before calling it.
+func (w *window) save() error {
+	return w.state.save()
+}
+
+// eachWindow calls fn for the time ranges of a dataset that still need to be
+// downloaded. An interrupted run is continued first, after that the range
+// between the newest written record and now is downloaded. Non-zero from and
+// to limit the ranges to the time range of a filter.
+func (s *exportState) eachWindow(account, dataset string, from, to time.Time, fn func(w *window) error) error {
+	ds := s.dataset(account, dataset)
+
+	for {
+		w := &window{
+			state: s,
+			ds:    ds,
+			since: ds.Done,
+			from:  from,
+			until: time.Now(),
+		}
+
+		if !to.IsZero() && to.Before(w.until) {
+			w.until = to
+		}
+
+		s.mu.Lock()
+
+		if ds.Pending != nil && ds.Pending.Cursor != nil {
+			w.resumed = true
+			w.until = ds.Pending.Cursor.Time
+		} else {
+			ds.Pending = &pendingState{}
+		}
+
+		s.mu.Unlock()
+
+		if err := fn(w); err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+
+		if ds.Pending.Newest != nil {
+			ds.Done = ds.Pending.Newest
+		}
+
+		ds.Pending = nil
+		s.mu.Unlock()
+
+		if err := s.save(); err != nil {
+			return err
+		}
+
+		if !w.resumed {
+			return nil
+		}
+	}
+}
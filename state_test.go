@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var stateBase = time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+
+func at(minutes int) time.Time {
+	return stateBase.Add(time.Duration(minutes) * time.Minute)
+}
+
+func TestWindowWritten(t *testing.T) {
+	tests := []struct {
+		name    string
+		since   *checkpoint
+		cursor  *checkpoint
+		t       time.Time
+		id      string
+		written bool
+	}{
+		{"first run", nil, nil, at(5), "a", false},
+		{"before since", &checkpoint{Time: at(5), IDs: []string{"a"}}, nil, at(4), "x", true},
+		{"since id", &checkpoint{Time: at(5), IDs: []string{"a"}}, nil, at(5), "a", true},
+		{"other id in since second", &checkpoint{Time: at(5), IDs: []string{"a"}}, nil, at(5), "b", false},
+		{"after since", &checkpoint{Time: at(5), IDs: []string{"a"}}, nil, at(6), "b", false},
+		{"after cursor", nil, &checkpoint{Time: at(8), IDs: []string{"c"}}, at(9), "d", true},
+		{"cursor id", nil, &checkpoint{Time: at(8), IDs: []string{"c"}}, at(8), "c", true},
+		{"other id in cursor second", nil, &checkpoint{Time: at(8), IDs: []string{"c"}}, at(8), "d", false},
+		{"between since and cursor", &checkpoint{Time: at(5)}, &checkpoint{Time: at(8)}, at(7), "e", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &window{since: tt.since, ds: &datasetState{Pending: &pendingState{Cursor: tt.cursor}}}
+
+			if got := w.written(tt.t, tt.id); got != tt.written {
+				t.Errorf("written(%s, %s) = %v, want %v", tt.t, tt.id, got, tt.written)
+			}
+		})
+	}
+}
+
+func TestWindowStart(t *testing.T) {
+	tests := []struct {
+		name  string
+		since *checkpoint
+		from  time.Time
+		want  time.Time
+	}{
+		{"first run", nil, time.Time{}, time.Unix(0, 0)},
+		{"since", &checkpoint{Time: at(5)}, time.Time{}, at(5)},
+		{"from after since", &checkpoint{Time: at(5)}, at(10), at(10)},
+		{"from before since", &checkpoint{Time: at(5)}, at(1), at(5)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &window{since: tt.since, from: tt.from}
+
+			if got := w.start(); !got.Equal(tt.want) {
+				t.Errorf("start() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestEachWindowResume interrupts a run and checks that the next run first
+// finishes the interrupted window and then downloads the newer records.
+func TestEachWindowResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), stateFile)
+	s, err := loadState(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A completed run up to minute 10.
+	err = s.eachWindow("Main", "fills", time.Time{}, time.Time{}, func(w *window) error {
+		w.add(at(10), "10")
+		w.add(at(5), "5")
+		return w.save()
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if done := s.dataset("Main", "fills").Done; done == nil || !done.Time.Equal(at(10)) {
+		t.Fatalf("Done = %+v, want minute 10", done)
+	}
+
+	// The next run writes minutes 30 and 20 and is interrupted.
+	interrupted := errors.New("interrupted")
+	err = s.eachWindow("Main", "fills", time.Time{}, time.Time{}, func(w *window) error {
+		if !w.since.Time.Equal(at(10)) {
+			t.Errorf("since = %s, want minute 10", w.since.Time)
+		}
+
+		w.add(at(30), "30")
+		w.add(at(20), "20")
+
+		if err := w.save(); err != nil {
+			return err
+		}
+
+		return interrupted
+	})
+
+	if !errors.Is(err, interrupted) {
+		t.Fatalf("err = %v, want %v", err, interrupted)
+	}
+
+	s, err = loadState(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var windows []*window
+
+	err = s.eachWindow("Main", "fills", time.Time{}, time.Time{}, func(w *window) error {
+		windows = append(windows, w)
+
+		if w.resumed && !w.written(at(30), "30") {
+			t.Error("resumed window downloads minute 30 again")
+		}
+
+		if w.resumed && w.written(at(15), "15") {
+			t.Error("resumed window skips minute 15")
+		}
+
+		if w.resumed {
+			w.add(at(15), "15")
+		}
+
+		return w.save()
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(windows) != 2 {
+		t.Fatalf("got %d windows, want the resumed one and a new one", len(windows))
+	}
+
+	if !windows[0].resumed || !windows[0].until.Equal(at(20)) || !windows[0].since.Time.Equal(at(10)) {
+		t.Errorf("resumed window = %s to %s, want minute 10 to 20", windows[0].since.Time, windows[0].until)
+	}
+
+	if windows[1].resumed || !windows[1].since.Time.Equal(at(30)) {
+		t.Errorf("second window starts at %s, want minute 30", windows[1].since.Time)
+	}
+
+	ds := s.dataset("Main", "fills")
+
+	if ds.Pending != nil || !ds.Done.Time.Equal(at(30)) {
+		t.Errorf("state = %+v, want done at minute 30 without pending run", ds)
+	}
+}
+
+func TestEachWindowTo(t *testing.T) {
+	s, err := loadState(filepath.Join(t.TempDir(), stateFile))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.eachWindow("Main", "fills", at(1), at(60), func(w *window) error {
+		if !w.until.Equal(at(60)) || !w.start().Equal(at(1)) {
+			t.Errorf("window = %s to %s, want minute 1 to 60", w.start(), w.until)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
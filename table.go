@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/shopspring/decimal"
+)
+
+// columnKind is the type of the values of a column.
+type columnKind int
+
+const (
+	kindString columnKind = iota
+	kindInt
+	kindDecimal
+	kindTime
+	kindBool
+)
+
+type column struct {
+	// Name in the CSV header.
+	name string
+	kind columnKind
+	// Name in typed outputs, snake_case of name when empty.
+	field string
+}
+
+func (c column) fieldName() string {
+	if c.field != "" {
+		return c.field
+	}
+
+	return snakeCase(c.name)
+}
+
+// table describes the records of a dataset for the outputs that keep types.
+// Values of a row are string, int64, decimal.Decimal, time.Time or bool,
+// matching the kind of their column.
+type table struct {
+	name    string
+	columns []column
+	// Fields identifying a record within an account.
+	primaryKey []string
+	// Fields that are indexed on their own.
+	indexes []string
+}
+
+func (t *table) header() []string {
+	header := make([]string, len(t.columns))
+
+	for i, c := range t.columns {
+		header[i] = c.name
+	}
+
+	return header
+}
+
+// formatRow formats the values of a row the way they are written to CSV.
+func formatRow(values []interface{}) []string {
+	row := make([]string, len(values))
+
+	for i, v := range values {
+		row[i] = formatValue(v)
+	}
+
+	return row
+}
+
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case decimal.Decimal:
+		return outFormat.decimal(v)
+	case time.Time:
+		return outFormat.time(v)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+
+	return ""
+}
+
+// snakeCase turns the CSV column names into field names, "TradeID" becomes
+// "trade_id".
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prevLower := unicode.IsLower(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+
+			if prevLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+
+		b.WriteRune(unicode.ToLower(r))
+	}
+
+	return b.String()
+}
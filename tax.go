@@ -0,0 +1,653 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kataras/golog"
+	"github.com/shopspring/decimal"
+)
+
+// taxKind is the kind of a taxEvent, every profile has a label for each kind.
+type taxKind int
+
+const (
+	taxTrade taxKind = iota
+	taxDeposit
+	taxWithdrawal
+	// Trading fee of a futures fill, spot fees are part of the trade.
+	taxTradingFee
+	taxFundingGain
+	taxFundingLoss
+	taxLending
+	taxBorrowCost
+	// Referral rebates and negative trading fees.
+	taxRebate
+	taxStaking
+	taxAirdrop
+	// Premiums of options fills.
+	taxOptionGain
+	taxOptionLoss
+)
+
+// taxEvent is a record of any dataset as a movement of coins, the form all
+// tax tools import. Amounts are positive, fees are paid in addition to the
+// sent amount.
+type taxEvent struct {
+	kind      taxKind
+	time      time.Time
+	inAmount  decimal.Decimal
+	inCoin    string
+	outAmount decimal.Decimal
+	outCoin   string
+	feeAmount decimal.Decimal
+	feeCoin   string
+	// Blockchain transaction of deposits and withdrawals.
+	txid    string
+	comment string
+}
+
+// loadTaxEvents reads the exported datasets of an account and returns them as
+// tax events, oldest first. Futures fills only contribute their fees, their
+// profits are settled through funding and the USD balance. Options fills are
+// their premium and their fee.
+func loadTaxEvents(dir, account string) ([]*taxEvent, error) {
+	var events []*taxEvent
+
+	add := func(e *taxEvent) {
+		events = append(events, e)
+	}
+
+	rebate := func(t time.Time, amount decimal.Decimal, coin, comment string) {
+		add(&taxEvent{kind: taxRebate, time: t, inAmount: amount, inCoin: coin, comment: comment})
+	}
+
+	fills, err := loadRecords(dir, account, "transaction_history")
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range fills {
+		t := f.time("time")
+		fee, feeCoin := f.dec("fee"), f.str("fee_currency")
+		comment := fmt.Sprintf("%s %s fill %d", f.str("market"), f.str("side"), f.int("id"))
+
+		if fee.IsNegative() {
+			rebate(t, fee.Neg(), feeCoin, comment+" maker rebate")
+			fee = decimal.Zero
+		}
+
+		if f.str("future") != "" {
+			if fee.IsPositive() {
+				add(&taxEvent{kind: taxTradingFee, time: t, outAmount: fee, outCoin: feeCoin, comment: comment})
+			}
+
+			continue
+		}
+
+		base := f.dec("size")
+		quote := base.Mul(f.dec("price"))
+		e := &taxEvent{kind: taxTrade, time: t, feeAmount: fee, feeCoin: feeCoin, comment: comment}
+
+		if f.str("side") == "buy" {
+			e.inAmount, e.inCoin = base, f.str("base_currency")
+			e.outAmount, e.outCoin = quote, f.str("quote_currency")
+		} else {
+			e.inAmount, e.inCoin = quote, f.str("quote_currency")
+			e.outAmount, e.outCoin = base, f.str("base_currency")
+		}
+
+		if fee.IsZero() {
+			e.feeCoin = ""
+		}
+
+		add(e)
+	}
+
+	deposits, err := loadRecords(dir, account, "deposit_history")
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range deposits {
+		if !transferDone(d.str("status")) {
+			continue
+		}
+
+		e := &taxEvent{kind: taxDeposit, time: d.time("time"), inAmount: d.dec("size"), inCoin: d.str("coin"), txid: d.str("txid"), comment: fmt.Sprintf("deposit %d", d.int("id"))}
+
+		if d.dec("fee").IsPositive() {
+			e.feeAmount, e.feeCoin = d.dec("fee"), d.str("coin")
+		}
+
+		add(e)
+	}
+
+	withdrawals, err := loadRecords(dir, account, "withdrawal_history")
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, w := range withdrawals {
+		if !transferDone(w.str("status")) {
+			continue
+		}
+
+		e := &taxEvent{kind: taxWithdrawal, time: w.time("time"), outAmount: w.dec("size"), outCoin: w.str("coin"), txid: w.str("txid"), comment: fmt.Sprintf("withdrawal %d", w.int("id"))}
+
+		if w.dec("fee").IsPositive() {
+			e.feeAmount, e.feeCoin = w.dec("fee"), w.str("coin")
+		}
+
+		add(e)
+	}
+
+	funding, err := loadRecords(dir, account, "futures_funding")
+
+	if err != nil {
+		return nil, err
+	}
+
+	// A positive payment was paid by the account.
+	for _, f := range funding {
+		payment := f.dec("payment")
+		comment := fmt.Sprintf("%s funding %d", f.str("future"), f.int("id"))
+
+		switch {
+		case payment.IsPositive():
+			add(&taxEvent{kind: taxFundingLoss, time: f.time("time"), outAmount: payment, outCoin: "USD", comment: comment})
+		case payment.IsNegative():
+			add(&taxEvent{kind: taxFundingGain, time: f.time("time"), inAmount: payment.Neg(), inCoin: "USD", comment: comment})
+		}
+	}
+
+	lending, err := loadRecords(dir, account, "lending_history")
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, l := range lending {
+		if l.dec("proceeds").IsPositive() {
+			add(&taxEvent{kind: taxLending, time: l.time("time"), inAmount: l.dec("proceeds"), inCoin: l.str("coin"), comment: "lending proceeds"})
+		}
+	}
+
+	borrows, err := loadRecords(dir, account, "borrow_history")
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, b := range borrows {
+		if b.dec("cost").IsPositive() {
+			add(&taxEvent{kind: taxBorrowCost, time: b.time("time"), outAmount: b.dec("cost"), outCoin: b.str("coin"), comment: "borrow cost"})
+		}
+	}
+
+	rebates, err := loadRecords(dir, account, "referral_rebates")
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range rebates {
+		if r.dec("size").IsPositive() {
+			rebate(r.time("day"), r.dec("size"), "USD", "referral rebate")
+		}
+	}
+
+	rewards, err := loadRecords(dir, account, "staking_rewards")
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range rewards {
+		if transferDone(r.str("status")) {
+			add(&taxEvent{kind: taxStaking, time: r.time("time"), inAmount: r.dec("size"), inCoin: r.str("coin"), comment: fmt.Sprintf("staking reward %d", r.int("id"))})
+		}
+	}
+
+	airdrops, err := loadRecords(dir, account, "airdrops")
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, a := range airdrops {
+		if transferDone(a.str("status")) {
+			add(&taxEvent{kind: taxAirdrop, time: a.time("time"), inAmount: a.dec("size"), inCoin: a.str("coin"), comment: fmt.Sprintf("airdrop %d", a.int("id"))})
+		}
+	}
+
+	conversions, err := loadRecords(dir, account, "conversions")
+
+	if err != nil {
+		return nil, err
+	}
+
+	// A filled quote is a trade without a fee.
+	for _, c := range conversions {
+		if c.bool("filled") {
+			add(&taxEvent{kind: taxTrade, time: c.time("time"), inAmount: c.dec("proceeds"), inCoin: c.str("to_coin"), outAmount: c.dec("cost"), outCoin: c.str("from_coin"), comment: fmt.Sprintf("conversion %d", c.int("id"))})
+		}
+	}
+
+	creations, err := loadRecords(dir, account, "lt_creations")
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range creations {
+		if c.bool("pending") {
+			continue
+		}
+
+		e := &taxEvent{kind: taxTrade, time: c.time("fulfilled_at"), inAmount: c.dec("created_size"), inCoin: c.str("token"), outAmount: c.dec("cost"), outCoin: "USD", comment: fmt.Sprintf("%s creation %d", c.str("token"), c.int("id"))}
+
+		if c.dec("fee").IsPositive() {
+			e.feeAmount, e.feeCoin = c.dec("fee"), "USD"
+		}
+
+		add(e)
+	}
+
+	redemptions, err := loadRecords(dir, account, "lt_redemptions")
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range redemptions {
+		if r.bool("pending") {
+			continue
+		}
+
+		e := &taxEvent{kind: taxTrade, time: r.time("fulfilled_at"), inAmount: r.dec("proceeds").Add(r.dec("fee")), inCoin: "USD", outAmount: r.dec("size"), outCoin: r.str("token"), comment: fmt.Sprintf("%s redemption %d", r.str("token"), r.int("id"))}
+
+		if r.dec("fee").IsPositive() {
+			e.feeAmount, e.feeCoin = r.dec("fee"), "USD"
+		}
+
+		add(e)
+	}
+
+	options, err := loadRecords(dir, account, "options_fills")
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, o := range options {
+		t := o.time("time")
+		premium := o.dec("size").Mul(o.dec("price"))
+		comment := fmt.Sprintf("%s %s options fill %d", optionOf(o), o.str("side"), o.int("id"))
+
+		if o.str("side") == "buy" {
+			add(&taxEvent{kind: taxOptionLoss, time: t, outAmount: premium, outCoin: "USD", comment: comment})
+		} else {
+			add(&taxEvent{kind: taxOptionGain, time: t, inAmount: premium, inCoin: "USD", comment: comment})
+		}
+
+		if o.dec("fee").IsPositive() {
+			add(&taxEvent{kind: taxTradingFee, time: t, outAmount: o.dec("fee"), outCoin: "USD", comment: comment})
+		}
+	}
+
+	// Deposits go first and withdrawals last within the same second, so
+	// the tools never see a negative balance.
+	rank := func(e *taxEvent) int {
+		switch e.kind {
+		case taxDeposit:
+			return 0
+		case taxWithdrawal:
+			return 2
+		}
+
+		return 1
+	}
+
+	sort.SliceStable(events, func(a, b int) bool {
+		if !events[a].time.Equal(events[b].time) {
+			return events[a].time.Before(events[b].time)
+		}
+
+		return rank(events[a]) < rank(events[b])
+	})
+
+	return events, nil
+}
+
+// transferDone reports whether a deposit or withdrawal was credited or sent.
+func transferDone(status string) bool {
+	return status == "confirmed" || status == "complete"
+}
+
+// taxProfile writes tax events in the universal import format of a tax tool.
+type taxProfile struct {
+	name   string
+	header []string
+	labels map[taxKind]string
+	// FTX coins that are known to the tool under another symbol.
+	symbols map[string]string
+	row     func(p *taxProfile, account string, e *taxEvent) []string
+}
+
+func (p *taxProfile) symbol(coin string) string {
+	if s, ok := p.symbols[coin]; ok {
+		return s
+	}
+
+	return coin
+}
+
+// amount formats an amount, empty when there is no coin.
+func amount(d decimal.Decimal, coin string) string {
+	if coin == "" {
+		return ""
+	}
+
+	return d.String()
+}
+
+var taxProfiles = []*taxProfile{
+	{
+		name:   "koinly",
+		header: []string{"Date", "Sent Amount", "Sent Currency", "Received Amount", "Received Currency", "Fee Amount", "Fee Currency", "Net Worth Amount", "Net Worth Currency", "Label", "Description", "TxHash"},
+		// Koinly tells trades, deposits and withdrawals apart by their amounts.
+		labels: map[taxKind]string{
+			taxTrade:       "",
+			taxDeposit:     "",
+			taxWithdrawal:  "",
+			taxTradingFee:  "cost",
+			taxFundingGain: "realized gain",
+			taxFundingLoss: "realized gain",
+			taxLending:     "loan interest",
+			taxBorrowCost:  "margin fee",
+			taxRebate:      "reward",
+			taxStaking:     "staking",
+			taxAirdrop:     "airdrop",
+			taxOptionGain:  "realized gain",
+			taxOptionLoss:  "realized gain",
+		},
+		symbols: map[string]string{"LUNA2": "LUNA"},
+		row: func(p *taxProfile, account string, e *taxEvent) []string {
+			return []string{
+				e.time.UTC().Format("2006-01-02 15:04:05 UTC"),
+				amount(e.outAmount, e.outCoin),
+				p.symbol(e.outCoin),
+				amount(e.inAmount, e.inCoin),
+				p.symbol(e.inCoin),
+				amount(e.feeAmount, e.feeCoin),
+				p.symbol(e.feeCoin),
+				"",
+				"",
+				p.labels[e.kind],
+				e.comment,
+				e.txid,
+			}
+		},
+	},
+	{
+		name:   "cointracking",
+		header: []string{"Type", "Buy Amount", "Buy Currency", "Sell Amount", "Sell Currency", "Fee", "Fee Currency", "Exchange", "Trade-Group", "Comment", "Date", "Tx-ID"},
+		labels: map[taxKind]string{
+			taxTrade:       "Trade",
+			taxDeposit:     "Deposit",
+			taxWithdrawal:  "Withdrawal",
+			taxTradingFee:  "Other Fee",
+			taxFundingGain: "Derivatives / Futures Profit",
+			taxFundingLoss: "Derivatives / Futures Loss",
+			taxLending:     "Lending Income",
+			taxBorrowCost:  "Borrowing Fee",
+			taxRebate:      "Reward / Bonus",
+			taxStaking:     "Staking",
+			taxAirdrop:     "Airdrop",
+			taxOptionGain:  "Derivatives / Futures Profit",
+			taxOptionLoss:  "Derivatives / Futures Loss",
+		},
+		row: func(p *taxProfile, account string, e *taxEvent) []string {
+			return []string{
+				p.labels[e.kind],
+				amount(e.inAmount, e.inCoin),
+				p.symbol(e.inCoin),
+				amount(e.outAmount, e.outCoin),
+				p.symbol(e.outCoin),
+				amount(e.feeAmount, e.feeCoin),
+				p.symbol(e.feeCoin),
+				"FTX",
+				account,
+				e.comment,
+				e.time.UTC().Format("2006-01-02 15:04:05"),
+				e.txid,
+			}
+		},
+	},
+	{
+		name:   "cointracker",
+		header: []string{"Date", "Received Quantity", "Received Currency", "Sent Quantity", "Sent Currency", "Fee Amount", "Fee Currency", "Tag"},
+		// Untagged rows are trades and transfers. Paid premiums are a loss of
+		// the USD paid, the other costs are fees.
+		labels: map[taxKind]string{
+			taxTrade:       "",
+			taxDeposit:     "",
+			taxWithdrawal:  "",
+			taxTradingFee:  "fee",
+			taxFundingGain: "income",
+			taxFundingLoss: "margin_fee",
+			taxLending:     "interest",
+			taxBorrowCost:  "margin_fee",
+			taxRebate:      "income",
+			taxStaking:     "staked",
+			taxAirdrop:     "airdrop",
+			taxOptionGain:  "income",
+			taxOptionLoss:  "lost",
+		},
+		row: func(p *taxProfile, account string, e *taxEvent) []string {
+			return []string{
+				e.time.UTC().Format("01/02/2006 15:04:05"),
+				amount(e.inAmount, e.inCoin),
+				p.symbol(e.inCoin),
+				amount(e.outAmount, e.outCoin),
+				p.symbol(e.outCoin),
+				amount(e.feeAmount, e.feeCoin),
+				p.symbol(e.feeCoin),
+				p.labels[e.kind],
+			}
+		},
+	},
+	{
+		name:   "accointing",
+		header: []string{"transactionType", "date", "inBuyAmount", "inBuyAsset", "outSellAmount", "outSellAsset", "feeAmount (optional)", "feeAsset (optional)", "classification (optional)", "operationId (optional)", "comments (optional)"},
+		// The transaction type tells trades and transfers apart.
+		labels: map[taxKind]string{
+			taxTrade:       "",
+			taxDeposit:     "",
+			taxWithdrawal:  "",
+			taxTradingFee:  "fee",
+			taxFundingGain: "margin_gain",
+			taxFundingLoss: "margin_loss",
+			taxLending:     "lending_income",
+			taxBorrowCost:  "fee",
+			taxRebate:      "income",
+			taxStaking:     "staked",
+			taxAirdrop:     "airdrop",
+			taxOptionGain:  "margin_gain",
+			taxOptionLoss:  "margin_loss",
+		},
+		row: func(p *taxProfile, account string, e *taxEvent) []string {
+			typ := "order"
+
+			switch {
+			case e.kind == taxTrade:
+			case e.inCoin != "":
+				typ = "deposit"
+			default:
+				typ = "withdraw"
+			}
+
+			return []string{
+				typ,
+				e.time.UTC().Format("01/02/2006 15:04:05"),
+				amount(e.inAmount, e.inCoin),
+				p.symbol(e.inCoin),
+				amount(e.outAmount, e.outCoin),
+				p.symbol(e.outCoin),
+				amount(e.feeAmount, e.feeCoin),
+				p.symbol(e.feeCoin),
+				p.labels[e.kind],
+				e.txid,
+				e.comment,
+			}
+		},
+	},
+	{
+		name:   "blockpit",
+		header: []string{"Date (UTC)", "Integration Name", "Label", "Outgoing Asset", "Outgoing Amount", "Incoming Asset", "Incoming Amount", "Fee Asset (optional)", "Fee Amount (optional)", "Comment (optional)", "Trx. ID (optional)"},
+		labels: map[taxKind]string{
+			taxTrade:       "Trade",
+			taxDeposit:     "Deposit",
+			taxWithdrawal:  "Withdrawal",
+			taxTradingFee:  "Fee",
+			taxFundingGain: "Derivative Profit",
+			taxFundingLoss: "Derivative Loss",
+			taxLending:     "Lending",
+			taxBorrowCost:  "Fee",
+			taxRebate:      "Income",
+			taxStaking:     "Staking",
+			taxAirdrop:     "Airdrop",
+			taxOptionGain:  "Derivative Profit",
+			taxOptionLoss:  "Derivative Loss",
+		},
+		symbols: map[string]string{"LUNA2": "LUNA"},
+		row: func(p *taxProfile, account string, e *taxEvent) []string {
+			return []string{
+				e.time.UTC().Format("02.01.2006 15:04:05"),
+				"FTX " + account,
+				p.labels[e.kind],
+				p.symbol(e.outCoin),
+				amount(e.outAmount, e.outCoin),
+				p.symbol(e.inCoin),
+				amount(e.inAmount, e.inCoin),
+				p.symbol(e.feeCoin),
+				amount(e.feeAmount, e.feeCoin),
+				e.comment,
+				e.txid,
+			}
+		},
+	},
+}
+
+// parseProfiles parses a comma separated list of profile names.
+func parseProfiles(list string) ([]*taxProfile, error) {
+	var profiles []*taxProfile
+
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		if name == "" {
+			continue
+		}
+
+		p := profileByName(name)
+
+		if p == nil {
+			return nil, fmt.Errorf("unknown profile %q, available: %s", name, strings.Join(profileNames(), ", "))
+		}
+
+		profiles = append(profiles, p)
+	}
+
+	return profiles, nil
+}
+
+func profileByName(name string) *taxProfile {
+	for _, p := range taxProfiles {
+		if p.name == name {
+			return p
+		}
+	}
+
+	return nil
+}
+
+func profileNames() []string {
+	names := make([]string, len(taxProfiles))
+
+	for i, p := range taxProfiles {
+		names[i] = p.name
+	}
+
+	return names
+}
+
+// writeProfiles writes the import file of every profile for every account,
+// "Main_koinly.csv", from the exported datasets in dir. It returns the
+// manifest items of the written files.
+func writeProfiles(dir string, accounts []string, profiles []*taxProfile) ([]*manifestItem, error) {
+	var items []*manifestItem
+
+	for _, account := range accounts {
+		events, err := loadTaxEvents(dir, account)
+
+		if err != nil {
+			return items, err
+		}
+
+		for _, p := range profiles {
+			path := filepath.Join(dir, fmt.Sprintf("%s_%s.csv", account, p.name))
+
+			if err := writeProfile(path, account, p, events); err != nil {
+				return items, err
+			}
+
+			golog.Infof("Wrote %d %s rows for %s", len(events), p.name, account)
+
+			// The tools expect commas whatever the text format is.
+			item := &manifestItem{Path: filepath.Base(path), Subaccount: subAccountOf(account), Dataset: p.name, Delimiter: ","}
+
+			if err := describeFile(path, "", item); err != nil {
+				return items, err
+			}
+
+			items = append(items, item)
+		}
+	}
+
+	return items, nil
+}
+
+func writeProfile(path, account string, p *taxProfile, events []*taxEvent) error {
+	file, err := os.Create(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	csvWriter := csv.NewWriter(file)
+	csvWriter.Write(p.header)
+
+	for _, e := range events {
+		csvWriter.Write(p.row(p, account, e))
+	}
+
+	csvWriter.Flush()
+
+	if err := csvWriter.Error(); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+// TestProfileLabels checks that every profile maps every kind of event and
+// that incomes, costs and losses never import as plain transfers.
+func TestProfileLabels(t *testing.T) {
+	plain := map[taxKind]bool{taxTrade: true, taxDeposit: true, taxWithdrawal: true}
+
+	for _, p := range taxProfiles {
+		t.Run(p.name, func(t *testing.T) {
+			for kind := taxTrade; kind <= taxOptionLoss; kind++ {
+				label, ok := p.labels[kind]
+
+				if !ok {
+					t.Errorf("kind %d has no label", kind)
+				}
+
+				if !plain[kind] && label == "" {
+					t.Errorf("kind %d imports as a plain transfer", kind)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/grishinsana/goftx"
+	"github.com/grishinsana/goftx/models"
+)
+
+// The leveraged token endpoints have no time window. Each list is fetched
+// once per export and paginate drops everything outside of the requested
+// window. Creations and redemptions are paid in USD, a creation costs Cost
+// plus the Fee, a redemption pays its Proceeds after the Fee.
+var tokenCreationsDataset = &csvDataset[*models.LeveragedTokenCreation]{
+	endpoints: []string{"/lt/creations"},
+	columns: &table{
+		name: "lt_creations",
+		columns: []column{
+			{name: "ID", kind: kindInt},
+			{name: "Token", kind: kindString},
+			{name: "RequestedSize", kind: kindDecimal},
+			{name: "Pending", kind: kindBool},
+			{name: "CreatedSize", kind: kindDecimal},
+			{name: "Price", kind: kindDecimal},
+			{name: "Cost", kind: kindDecimal},
+			{name: "Fee", kind: kindDecimal},
+			{name: "RequestedAt", kind: kindTime},
+			{name: "FulfilledAt", kind: kindTime},
+		},
+		primaryKey: []string{"id"},
+		indexes:    []string{"requested_at", "token"},
+	},
+	fetch: func(client *goftx.Client, _ *exportFilter) pageFunc[*models.LeveragedTokenCreation] {
+		var creations []*models.LeveragedTokenCreation
+		fetched := false
+
+		return func(start, end int64) ([]*models.LeveragedTokenCreation, error) {
+			if !fetched {
+				c, err := client.LeveragedTokens.GetCreations()
+
+				if err != nil {
+					return nil, err
+				}
+
+				creations, fetched = c, true
+			}
+
+			return creations, nil
+		}
+	},
+	key: func(c *models.LeveragedTokenCreation) (time.Time, string) {
+		return c.RequestedAt, strconv.FormatInt(c.ID, 10)
+	},
+	subject: func(c *models.LeveragedTokenCreation) ([]string, string) {
+		return []string{c.Token, "USD"}, ""
+	},
+	values: func(c *models.LeveragedTokenCreation) []interface{} {
+		return []interface{}{
+			c.ID,
+			c.Token,
+			c.RequestedSize,
+			c.Pending,
+			c.CreatedSize,
+			c.Price,
+			c.Cost,
+			c.Fee,
+			c.RequestedAt,
+			c.FulfilledAt,
+		}
+	},
+}
+
+var tokenRedemptionsDataset = &csvDataset[*models.LeveragedTokenRedemption]{
+	endpoints: []string{"/lt/redemptions"},
+	columns: &table{
+		name: "lt_redemptions",
+		columns: []column{
+			{name: "ID", kind: kindInt},
+			{name: "Token", kind: kindString},
+			{name: "Size", kind: kindDecimal},
+			{name: "Pending", kind: kindBool},
+			{name: "Price", kind: kindDecimal},
+			{name: "Proceeds", kind: kindDecimal},
+			{name: "Fee", kind: kindDecimal},
+			{name: "RequestedAt", kind: kindTime},
+			{name: "FulfilledAt", kind: kindTime},
+		},
+		primaryKey: []string{"id"},
+		indexes:    []string{"requested_at", "token"},
+	},
+	fetch: func(client *goftx.Client, _ *exportFilter) pageFunc[*models.LeveragedTokenRedemption] {
+		var redemptions []*models.LeveragedTokenRedemption
+		fetched := false
+
+		return func(start, end int64) ([]*models.LeveragedTokenRedemption, error) {
+			if !fetched {
+				r, err := client.LeveragedTokens.GetRedemptions()
+
+				if err != nil {
+					return nil, err
+				}
+
+				redemptions, fetched = r, true
+			}
+
+			return redemptions, nil
+		}
+	},
+	key: func(r *models.LeveragedTokenRedemption) (time.Time, string) {
+		return r.RequestedAt, strconv.FormatInt(r.ID, 10)
+	},
+	subject: func(r *models.LeveragedTokenRedemption) ([]string, string) {
+		return []string{r.Token, "USD"}, ""
+	},
+	values: func(r *models.LeveragedTokenRedemption) []interface{} {
+		return []interface{}{
+			r.ID,
+			r.Token,
+			r.Size,
+			r.Pending,
+			r.Price,
+			r.Proceeds,
+			r.Fee,
+			r.RequestedAt,
+			r.FulfilledAt,
+		}
+	},
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kataras/golog"
+	"github.com/shopspring/decimal"
+)
+
+// valuation names the amounts of a dataset that are valued in USD.
+type valuation struct {
+	amount func(r record) (decimal.Decimal, string)
+	// Fee of the record, nil when the dataset has none.
+	fee func(r record) (decimal.Decimal, string)
+}
+
+// valuations are keyed by dataset. Fills are valued by their quote amount,
+// futures fills by their USD notional, conversions by the converted amount.
+var valuations = map[string]valuation{
+	"transaction_history": {
+		amount: func(r record) (decimal.Decimal, string) {
+			if r.str("future") != "" {
+				return r.dec("size").Mul(r.dec("price")), "USD"
+			}
+
+			return r.dec("size").Mul(r.dec("price")), r.str("quote_currency")
+		},
+		fee: func(r record) (decimal.Decimal, string) {
+			return r.dec("fee"), r.str("fee_currency")
+		},
+	},
+	"withdrawal_history": {
+		amount: func(r record) (decimal.Decimal, string) {
+			return r.dec("size"), r.str("coin")
+		},
+		fee: func(r record) (decimal.Decimal, string) {
+			return r.dec("fee"), r.str("coin")
+		},
+	},
+	"deposit_history": {
+		amount: func(r record) (decimal.Decimal, string) {
+			return r.dec("size"), r.str("coin")
+		},
+		fee: func(r record) (decimal.Decimal, string) {
+			return r.dec("fee"), r.str("coin")
+		},
+	},
+	"referral_rebates": {
+		amount: func(r record) (decimal.Decimal, string) {
+			return r.dec("size"), "USD"
+		},
+	},
+	"futures_funding": {
+		amount: func(r record) (decimal.Decimal, string) {
+			return r.dec("payment"), "USD"
+		},
+	},
+	"borrow_history": {
+		amount: func(r record) (decimal.Decimal, string) {
+			return r.dec("cost"), r.str("coin")
+		},
+	},
+	"lending_history": {
+		amount: func(r record) (decimal.Decimal, string) {
+			return r.dec("proceeds"), r.str("coin")
+		},
+	},
+	"staking_rewards": {
+		amount: func(r record) (decimal.Decimal, string) {
+			return r.dec("size"), r.str("coin")
+		},
+	},
+	"airdrops": {
+		amount: func(r record) (decimal.Decimal, string) {
+			return r.dec("size"), r.str("coin")
+		},
+	},
+	"conversions": {
+		amount: func(r record) (decimal.Decimal, string) {
+			return r.dec("cost"), r.str("from_coin")
+		},
+	},
+	"lt_creations": {
+		amount: func(r record) (decimal.Decimal, string) {
+			return r.dec("cost"), "USD"
+		},
+		fee: func(r record) (decimal.Decimal, string) {
+			return r.dec("fee"), "USD"
+		},
+	},
+	"lt_redemptions": {
+		amount: func(r record) (decimal.Decimal, string) {
+			return r.dec("proceeds"), "USD"
+		},
+		fee: func(r record) (decimal.Decimal, string) {
+			return r.dec("fee"), "USD"
+		},
+	},
+	"options_fills": {
+		amount: func(r record) (decimal.Decimal, string) {
+			return r.dec("size").Mul(r.dec("price")), "USD"
+		},
+		fee: func(r record) (decimal.Decimal, string) {
+			return r.dec("fee"), "USD"
+		},
+	},
+}
+
+var valuationColumns = []string{"ValueUSD", "FeeUSD", "PriceSource"}
+
+// valueDir writes a copy of every CSV dataset of the accounts in dir with
+// the USD value of each row at its timestamp, "Main_transaction_history_usd.csv".
+// It returns the manifest items of the written files.
+func valueDir(dir string, accounts []string, prices *priceCache) ([]*manifestItem, error) {
+	var items []*manifestItem
+
+	for _, account := range accounts {
+		for _, f := range fetchers {
+			v, ok := valuations[f.dataset]
+
+			if !ok {
+				continue
+			}
+
+			recs, err := loadRecords(dir, account, f.dataset)
+
+			if err != nil {
+				return items, err
+			}
+
+			if recs == nil {
+				continue
+			}
+
+			path := strings.TrimSuffix(exportPath(dir, account, f), f.ext) + "_usd.csv"
+			missing, err := writeValued(path, f, v, recs, prices)
+
+			if err != nil {
+				return items, err
+			}
+
+			golog.Infof("Valued %d %s for %s", len(recs), f.label, account)
+
+			if missing > 0 {
+				golog.Warnf("%d %s of %s have no USD price", missing, f.label, account)
+			}
+
+			items = append(items, &manifestItem{Path: filepath.Base(path), Subaccount: subAccountOf(account), Dataset: f.dataset + "_usd"})
+		}
+	}
+
+	return items, nil
+}
+
+// writeValued writes the records with their values and returns the number of
+// rows whose amount or fee could not be valued.
+func writeValued(path string, f fetcher, v valuation, recs []record, prices *priceCache) (int, error) {
+	file, err := os.Create(path)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer file.Close()
+
+	t := f.ds.table()
+	timeField := snakeCase(f.timeColumn)
+	csvWriter := outFormat.csvWriter(file)
+	csvWriter.Write(append(t.header(), valuationColumns...))
+	missing := 0
+
+	for _, r := range recs {
+		at := r.time(timeField)
+		row := make([]string, 0, len(t.columns)+len(valuationColumns))
+
+		for _, c := range t.columns {
+			row = append(row, formatValue(r[c.fieldName()]))
+		}
+
+		amount, coin := v.amount(r)
+		price, source, ok, err := prices.usdPrice(coin, at)
+
+		if err != nil {
+			return missing, err
+		}
+
+		value, feeValue := "", ""
+		var sources []string
+
+		priced := ok
+
+		if ok {
+			value = outFormat.decimal(amount.Mul(price).Round(8))
+			sources = append(sources, fmt.Sprintf("%s: %s", coin, source))
+		}
+
+		if v.fee != nil {
+			fee, feeCoin := v.fee(r)
+
+			if fee.IsZero() {
+				feeValue = "0"
+			} else {
+				feePrice, feeSource, ok, err := prices.usdPrice(feeCoin, at)
+
+				if err != nil {
+					return missing, err
+				}
+
+				if ok {
+					feeValue = outFormat.decimal(fee.Mul(feePrice).Round(8))
+
+					if feeCoin != coin {
+						sources = append(sources, fmt.Sprintf("%s: %s", feeCoin, feeSource))
+					}
+				}
+
+				priced = priced && ok
+			}
+		}
+
+		if !priced {
+			missing++
+		}
+
+		csvWriter.Write(append(row, value, feeValue, strings.Join(sources, "; ")))
+	}
+
+	csvWriter.Flush()
+
+	if err := csvWriter.Error(); err != nil {
+		return missing, err
+	}
+
+	return missing, file.Close()
+}
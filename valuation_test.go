@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestWriteValuedFills(t *testing.T) {
+	tests := []struct {
+		name   string
+		fill   record
+		value  string
+		fee    string
+		source string
+		// Markets whose candles are looked up.
+		lookups int
+		missing int
+	}{
+		{
+			name:   "futures fill",
+			fill:   record{"future": "BTC-PERP", "market": "BTC-PERP", "price": dec("20000"), "size": dec("0.5"), "fee": dec("5"), "fee_currency": "USD"},
+			value:  "10000",
+			fee:    "5",
+			source: "USD: USD",
+		},
+		{
+			name:   "spot fill in USD",
+			fill:   record{"market": "BTC/USD", "base_currency": "BTC", "quote_currency": "USD", "price": dec("20000"), "size": dec("0.5"), "fee": decimal.Zero, "fee_currency": "USD"},
+			value:  "10000",
+			fee:    "0",
+			source: "USD: USD",
+		},
+		{
+			name:    "spot fill without candles",
+			fill:    record{"market": "SOL/BTC", "base_currency": "SOL", "quote_currency": "BTC", "price": dec("0.002"), "size": dec("10"), "fee": decimal.Zero, "fee_currency": "BTC"},
+			fee:     "0",
+			lookups: 2,
+			missing: 1,
+		},
+		{
+			name:    "fee without candles",
+			fill:    record{"market": "BTC/USD", "base_currency": "BTC", "quote_currency": "USD", "price": dec("20000"), "size": dec("0.5"), "fee": dec("1"), "fee_currency": "FTT"},
+			value:   "10000",
+			source:  "USD: USD",
+			lookups: 2,
+			missing: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "Main_transaction_history_usd.csv")
+			prices := newPriceCache(context.Background(), filepath.Join(dir, priceCacheDir), nil)
+			tt.fill["time"] = at(0)
+
+			missing, err := writeValued(path, fetcherOf("transaction_history"), valuations["transaction_history"], []record{tt.fill}, prices)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if missing != tt.missing {
+				t.Errorf("missing = %d, want %d", missing, tt.missing)
+			}
+
+			if len(prices.months) != tt.lookups {
+				t.Errorf("looked up %d markets, want %d", len(prices.months), tt.lookups)
+			}
+
+			file, err := os.Open(path)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer file.Close()
+
+			rows, err := outFormat.csvReader(file).ReadAll()
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			row := rows[1]
+			got := row[len(row)-len(valuationColumns):]
+
+			if got[0] != tt.value || got[1] != tt.fee || got[2] != tt.source {
+				t.Errorf("ValueUSD, FeeUSD, PriceSource = %q, want %q, %q, %q", got, tt.value, tt.fee, tt.source)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/grishinsana/goftx"
+	"github.com/grishinsana/goftx/models"
+)
+
+// accountValueLimit is the number of daily snapshots requested, enough for
+// the whole life of FTX.
+const accountValueLimit = 10000
+
+// accountValues returns the snapshots of a history, newest first.
+func accountValues(h *models.AccountValueHistory) []*models.AccountValue {
+	values := make([]*models.AccountValue, len(h.Records))
+
+	for i := range h.Records {
+		values[i] = &h.Records[i]
+	}
+
+	return values
+}
+
+// The USD value snapshots, the equity curve of the account, have no time
+// window. The history is fetched once per export and paginate drops
+// everything outside of the requested window.
+var accountValueDataset = &csvDataset[*models.AccountValue]{
+	endpoints: []string{"/wallet/usd_value_snapshots"},
+	columns: &table{
+		name: "account_value",
+		columns: []column{
+			{name: "Time", kind: kindTime},
+			{name: "UsdValue", kind: kindDecimal},
+		},
+		primaryKey: []string{"subaccount", "time"},
+		indexes:    []string{"time"},
+	},
+	fetch: func(client *goftx.Client, _ *exportFilter) pageFunc[*models.AccountValue] {
+		var history *models.AccountValueHistory
+
+		return func(start, end int64) ([]*models.AccountValue, error) {
+			if history == nil {
+				h, err := client.GetAccountValueHistory(accountValueLimit)
+
+				if err != nil {
+					return nil, err
+				}
+
+				history = h
+			}
+
+			return accountValues(history), nil
+		}
+	},
+	key: func(v *models.AccountValue) (time.Time, string) {
+		return v.Time, ""
+	},
+	// The value of the account is not the activity of a coin or market.
+	subject: func(v *models.AccountValue) ([]string, string) {
+		return nil, ""
+	},
+	decode: func(page json.RawMessage) ([]*models.AccountValue, error) {
+		var h models.AccountValueHistory
+
+		if err := json.Unmarshal(page, &h); err != nil {
+			return nil, err
+		}
+
+		return accountValues(&h), nil
+	},
+	values: func(v *models.AccountValue) []interface{} {
+		return []interface{}{
+			v.Time,
+			v.UsdValue,
+		}
+	},
+}
+
+var balancesDataset = &snapshotDataset[*models.Balance]{
+	endpoint: "/wallet/balances",
+	columns: &table{
+		name: "balances",
+		columns: []column{
+			{name: "Time", kind: kindTime},
+			{name: "Coin", kind: kindString},
+			{name: "Free", kind: kindDecimal},
+			{name: "Total", kind: kindDecimal},
+			{name: "UsdValue", kind: kindDecimal},
+			{name: "SpotBorrow", kind: kindDecimal},
+			{name: "AvailableWithoutBorrow", kind: kindDecimal},
+		},
+		primaryKey: []string{"subaccount", "time", "coin"},
+		indexes:    []string{"time", "coin"},
+	},
+	fetch: func(client *goftx.Client) ([]*models.Balance, error) {
+		return client.GetBalances()
+	},
+	subject: func(b *models.Balance) ([]string, string) {
+		return []string{b.Coin}, ""
+	},
+	values: func(b *models.Balance) []interface{} {
+		return []interface{}{
+			b.Coin,
+			b.Free,
+			b.Total,
+			b.UsdValue,
+			b.SpotBorrow,
+			b.AvailableWithoutBorrow,
+		}
+	},
+}
+
+var positionsDataset = &snapshotDataset[*models.Position]{
+	endpoint: "/positions",
+	columns: &table{
+		name: "positions",
+		columns: []column{
+			{name: "Time", kind: kindTime},
+			{name: "Future", kind: kindString},
+			{name: "Side", kind: kindString},
+			{name: "Size", kind: kindDecimal},
+			{name: "NetSize", kind: kindDecimal},
+			{name: "OpenSize", kind: kindDecimal},
+			{name: "LongOrderSize", kind: kindDecimal},
+			{name: "ShortOrderSize", kind: kindDecimal},
+			{name: "EntryPrice", kind: kindDecimal},
+			{name: "Cost", kind: kindDecimal},
+			{name: "EstimatedLiquidationPrice", kind: kindDecimal},
+			{name: "UnrealizedPnl", kind: kindDecimal},
+			{name: "RealizedPnl", kind: kindDecimal},
+			{name: "RecentPnl", kind: kindDecimal},
+			{name: "CollateralUsed", kind: kindDecimal},
+			{name: "InitialMarginRequirement", kind: kindDecimal},
+			{name: "MaintenanceMarginRequirement", kind: kindDecimal},
+		},
+		primaryKey: []string{"subaccount", "time", "future"},
+		indexes:    []string{"time", "future"},
+	},
+	fetch: func(client *goftx.Client) ([]*models.Position, error) {
+		return client.GetPositions()
+	},
+	subject: func(p *models.Position) ([]string, string) {
+		return []string{underlying(p.Future)}, p.Future
+	},
+	values: func(p *models.Position) []interface{} {
+		return []interface{}{
+			p.Future,
+			p.Side,
+			p.Size,
+			p.NetSize,
+			p.OpenSize,
+			p.LongOrderSize,
+			p.ShortOrderSize,
+			p.EntryPrice,
+			p.Cost,
+			p.EstimatedLiquidationPrice,
+			p.UnrealizedPnl,
+			p.RealizedPnl,
+			p.RecentPnl,
+			p.CollateralUsed,
+			p.InitialMarginRequirement,
+			p.MaintenanceMarginRequirement,
+		}
+	},
+}
+
+// Airdrops are credited to the account like a deposit without a transfer.
+var airdropsDataset = &csvDataset[*models.Airdrop]{
+	endpoints: []string{"/wallet/airdrops"},
+	columns: &table{
+		name: "airdrops",
+		columns: []column{
+			{name: "Coin", kind: kindString},
+			{name: "ID", kind: kindInt},
+			{name: "Size", kind: kindDecimal},
+			{name: "Status", kind: kindString},
+			{name: "Time", kind: kindTime},
+		},
+		primaryKey: []string{"id"},
+		indexes:    []string{"time", "coin"},
+	},
+	fetch: func(client *goftx.Client, _ *exportFilter) pageFunc[*models.Airdrop] {
+		return client.GetAirdrops
+	},
+	pageSize: ftxPageSize,
+	key: func(a *models.Airdrop) (time.Time, string) {
+		return a.Time, strconv.FormatInt(a.ID, 10)
+	},
+	subject: func(a *models.Airdrop) ([]string, string) {
+		return []string{a.Coin}, ""
+	},
+	values: func(a *models.Airdrop) []interface{} {
+		return []interface{}{
+			a.Coin,
+			a.ID,
+			a.Size,
+			a.Status,
+			a.Time,
+		}
+	},
+}
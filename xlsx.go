@@ -0,0 +1,398 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kataras/golog"
+	"github.com/shopspring/decimal"
+	"github.com/xuri/excelize/v2"
+)
+
+const summarySheet = "Summary"
+
+// workbookStyles are the cell styles shared by all sheets of a workbook.
+type workbookStyles struct {
+	header int
+	time   int
+}
+
+func newWorkbookStyles(book *excelize.File) (*workbookStyles, error) {
+	header, err := book.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+
+	if err != nil {
+		return nil, err
+	}
+
+	timeFormat := "yyyy-mm-dd hh:mm:ss"
+	timeStyle, err := book.NewStyle(&excelize.Style{CustomNumFmt: &timeFormat})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &workbookStyles{header: header, time: timeStyle}, nil
+}
+
+// xlsxCell turns a value read back from a CSV file into a typed cell.
+// Decimals become numbers, times become Excel dates in the timezone of the
+// output format.
+func xlsxCell(v interface{}, styles *workbookStyles) interface{} {
+	switch v := v.(type) {
+	case decimal.Decimal:
+		return number(v)
+	case time.Time:
+		if v.IsZero() {
+			return nil
+		}
+
+		return excelize.Cell{StyleID: styles.time, Value: v.In(outFormat.loc)}
+	}
+
+	return v
+}
+
+// number returns the closest float, Excel has no decimal type.
+func number(d decimal.Decimal) float64 {
+	f, _ := d.Float64()
+	return f
+}
+
+// datasetTotal is the sum of the amounts and fees of a dataset in one coin.
+type datasetTotal struct {
+	coin   string
+	amount decimal.Decimal
+	fee    decimal.Decimal
+}
+
+// datasetTotals adds up the amounts of the records per coin, the amounts that
+// are valued in USD by the value command.
+func datasetTotals(dataset string, recs []record) []*datasetTotal {
+	v, ok := valuations[dataset]
+
+	if !ok {
+		return nil
+	}
+
+	byCoin := map[string]*datasetTotal{}
+
+	total := func(coin string) *datasetTotal {
+		if byCoin[coin] == nil {
+			byCoin[coin] = &datasetTotal{coin: coin}
+		}
+
+		return byCoin[coin]
+	}
+
+	for _, r := range recs {
+		amount, coin := v.amount(r)
+		t := total(coin)
+		t.amount = t.amount.Add(amount)
+
+		if v.fee != nil {
+			fee, feeCoin := v.fee(r)
+
+			if !fee.IsZero() {
+				t := total(feeCoin)
+				t.fee = t.fee.Add(fee)
+			}
+		}
+	}
+
+	totals := make([]*datasetTotal, 0, len(byCoin))
+
+	for _, t := range byCoin {
+		totals = append(totals, t)
+	}
+
+	sort.Slice(totals, func(a, b int) bool {
+		return totals[a].coin < totals[b].coin
+	})
+
+	return totals
+}
+
+// maxSheetName is the longest sheet name Excel accepts.
+const maxSheetName = 31
+
+// sheetNamer names the sheets of a workbook "<subaccount> <dataset>" and the
+// tables on them after their sheet. Both are unique in the workbook regardless
+// of case, as Excel requires.
+type sheetNamer struct {
+	used map[string]bool
+}
+
+func newSheetNamer() *sheetNamer {
+	return &sheetNamer{used: map[string]bool{strings.ToLower(summarySheet): true}}
+}
+
+// name returns the sheet and table name of a dataset of an account. Long
+// subaccount names are shortened so that the dataset stays readable, names
+// that are taken get a number.
+func (n *sheetNamer) name(account, dataset string) (sheet, table string) {
+	account = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`:\/?*[]'`, r) {
+			return '_'
+		}
+
+		return r
+	}, account)
+
+	for i := 1; ; i++ {
+		suffix := " " + dataset
+
+		if i > 1 {
+			suffix = fmt.Sprintf(" %s %d", dataset, i)
+		}
+
+		prefix := []rune(account)
+
+		if room := maxSheetName - len([]rune(suffix)); len(prefix) > room {
+			prefix = prefix[:room]
+		}
+
+		sheet = strings.TrimSpace(string(prefix) + suffix)
+		table = tableName(sheet)
+
+		if !n.used[strings.ToLower(sheet)] && !n.used[strings.ToLower(table)] {
+			n.used[strings.ToLower(sheet)] = true
+			n.used[strings.ToLower(table)] = true
+			return sheet, table
+		}
+	}
+}
+
+// tableName turns a sheet name into a table name, which may only hold
+// letters, digits and underscores and must not start with a digit.
+func tableName(sheet string) string {
+	name := []rune(sheet)
+
+	for i, r := range name {
+		if !(r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_') {
+			name[i] = '_'
+		}
+	}
+
+	if len(name) == 0 || name[0] >= '0' && name[0] <= '9' {
+		return "_" + string(name)
+	}
+
+	return string(name)
+}
+
+// writeDatasetSheet streams the records of a dataset into a new sheet with a
+// frozen header and a table, which gives the header an autofilter.
+func writeDatasetSheet(book *excelize.File, styles *workbookStyles, sheet, table string, f fetcher, recs []record) error {
+	t := f.ds.table()
+
+	if _, err := book.NewSheet(sheet); err != nil {
+		return err
+	}
+
+	sw, err := book.NewStreamWriter(sheet)
+
+	if err != nil {
+		return err
+	}
+
+	if err := sw.SetPanes(&excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"}); err != nil {
+		return err
+	}
+
+	header := make([]interface{}, len(t.columns))
+
+	for i, c := range t.columns {
+		header[i] = excelize.Cell{StyleID: styles.header, Value: c.name}
+
+		width := 14.0
+
+		if c.kind == kindTime {
+			width = 20
+		}
+
+		if err := sw.SetColWidth(i+1, i+1, width); err != nil {
+			return err
+		}
+	}
+
+	if err := sw.SetRow("A1", header); err != nil {
+		return err
+	}
+
+	for n, r := range recs {
+		row := make([]interface{}, len(t.columns))
+
+		for i, c := range t.columns {
+			row[i] = xlsxCell(r[c.fieldName()], styles)
+		}
+
+		if err := sw.SetRow(fmt.Sprintf("A%d", n+2), row); err != nil {
+			return err
+		}
+	}
+
+	last, err := excelize.CoordinatesToCellName(len(t.columns), len(recs)+1)
+
+	if err != nil {
+		return err
+	}
+
+	if err := sw.AddTable(&excelize.Table{Range: "A1:" + last, Name: table, StyleName: "TableStyleLight1"}); err != nil {
+		return err
+	}
+
+	return sw.Flush()
+}
+
+// writeWorkbook writes the CSV datasets of all accounts into one workbook with
+// one sheet per account and dataset and a summary sheet of row counts, time
+// ranges and totals per coin.
+func writeWorkbook(dir string, accounts []string) (string, error) {
+	book := excelize.NewFile()
+	defer book.Close()
+
+	styles, err := newWorkbookStyles(book)
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := book.SetSheetName(book.GetSheetName(0), summarySheet); err != nil {
+		return "", err
+	}
+
+	summary := [][]interface{}{{"Subaccount", "Dataset", "Sheet", "Rows", "From", "To", "Coin", "Total", "Fees"}}
+	names := newSheetNamer()
+
+	for _, account := range accounts {
+		for _, f := range fetchers {
+			if f.ext != ".csv" {
+				continue
+			}
+
+			recs, err := loadRecords(dir, account, f.dataset)
+
+			if err != nil {
+				return "", err
+			}
+
+			sheet, table := names.name(account, f.dataset)
+
+			if err := writeDatasetSheet(book, styles, sheet, table, f, recs); err != nil {
+				return "", fmt.Errorf("%s sheet: %w", sheet, err)
+			}
+
+			var from, to interface{}
+
+			if first, last, ok := timeRangeOf(recs, snakeCase(f.timeColumn)); ok {
+				from = xlsxCell(first, styles)
+				to = xlsxCell(last, styles)
+			}
+
+			totals := datasetTotals(f.dataset, recs)
+
+			if len(totals) == 0 {
+				summary = append(summary, []interface{}{account, f.dataset, sheet, len(recs), from, to})
+			}
+
+			for _, t := range totals {
+				summary = append(summary, []interface{}{account, f.dataset, sheet, len(recs), from, to, t.coin, number(t.amount), number(t.fee)})
+			}
+		}
+	}
+
+	for i, row := range summary {
+		cell, err := excelize.CoordinatesToCellName(1, i+1)
+
+		if err != nil {
+			return "", err
+		}
+
+		values := make([]interface{}, len(row))
+
+		for j, v := range row {
+			if c, ok := v.(excelize.Cell); ok {
+				v = c.Value
+			}
+
+			values[j] = v
+		}
+
+		if err := book.SetSheetRow(summarySheet, cell, &values); err != nil {
+			return "", err
+		}
+	}
+
+	if err := book.SetRowStyle(summarySheet, 1, 1, styles.header); err != nil {
+		return "", err
+	}
+
+	if err := book.SetColStyle(summarySheet, "E:F", styles.time); err != nil {
+		return "", err
+	}
+
+	if err := book.SetColWidth(summarySheet, "A", "I", 20); err != nil {
+		return "", err
+	}
+
+	if err := book.SetPanes(summarySheet, &excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"}); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, "ftx.xlsx")
+
+	if err := book.SaveAs(path); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
+// timeRangeOf returns the oldest and newest time of a field of the records,
+// whatever order they are in.
+func timeRangeOf(recs []record, field string) (first, last time.Time, ok bool) {
+	for _, r := range recs {
+		t := r.time(field)
+
+		if t.IsZero() {
+			continue
+		}
+
+		if !ok || t.Before(first) {
+			first = t
+		}
+
+		if !ok || t.After(last) {
+			last = t
+		}
+
+		ok = true
+	}
+
+	return first, last, ok
+}
+
+// writeWorkbooks writes the workbook of all accounts, "ftx.xlsx", and returns
+// the manifest items of the written files.
+func writeWorkbooks(dir string, accounts []string) ([]*manifestItem, error) {
+	var items []*manifestItem
+
+	path, err := writeWorkbook(dir, accounts)
+
+	if err != nil {
+		return items, fmt.Errorf("workbook: %w", err)
+	}
+
+	golog.Infof("Wrote workbook of %d accounts to %s", len(accounts), path)
+
+	item := &manifestItem{Path: filepath.Base(path), Dataset: "workbook"}
+
+	if err := describeFile(path, "", item); err != nil {
+		return items, err
+	}
+
+	return append(items, item), nil
+}
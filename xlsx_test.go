@@ -0,0 +1,134 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestSheetNamer(t *testing.T) {
+	tests := []struct {
+		name     string
+		accounts []string
+		dataset  string
+		// Sheet and table name of every account.
+		want []string
+	}{
+		{"main account", []string{"Main"}, "transaction_history", []string{"Main transaction_history Main_transaction_history"}},
+		{
+			name:     "long subaccounts",
+			accounts: []string{"Trading bot 1", "Trading bot 2"},
+			dataset:  "transaction_history",
+			want: []string{
+				"Trading bot transaction_history Trading_bot_transaction_history",
+				"Trading b transaction_history 2 Trading_b_transaction_history_2",
+			},
+		},
+		{
+			name:     "same table name",
+			accounts: []string{"a-b", "a b", "A-B"},
+			dataset:  "fills",
+			want:     []string{"a-b fills a_b_fills", "a b fills 2 a_b_fills_2", "A-B fills 3 A_B_fills_3"},
+		},
+		{
+			name:     "forbidden characters",
+			accounts: []string{"2x/[hedge]"},
+			dataset:  "fills",
+			want:     []string{"2x__hedge_ fills _2x__hedge__fills"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names := newSheetNamer()
+			var got []string
+
+			for _, account := range tt.accounts {
+				sheet, table := names.name(account, tt.dataset)
+
+				if n := len([]rune(sheet)); n > maxSheetName {
+					t.Errorf("sheet %q has %d characters", sheet, n)
+				}
+
+				got = append(got, sheet+" "+table)
+			}
+
+			if strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+				t.Errorf("names = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteWorkbook(t *testing.T) {
+	dir := t.TempDir()
+	accounts := []string{"Main", "Trading bot 1", "Trading bot 2"}
+	path, err := writeWorkbook(dir, accounts)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	book, err := excelize.OpenFile(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer book.Close()
+
+	csvDatasets := 0
+
+	for _, f := range fetchers {
+		if f.ext == ".csv" {
+			csvDatasets++
+		}
+	}
+
+	sheets := book.GetSheetList()
+
+	if want := 1 + len(accounts)*csvDatasets; len(sheets) != want {
+		t.Fatalf("%d sheets, want %d", len(sheets), want)
+	}
+
+	tables := map[string]bool{}
+
+	for _, sheet := range sheets[1:] {
+		sheetTables, err := book.GetTables(sheet)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, table := range sheetTables {
+			if tables[strings.ToLower(table.Name)] {
+				t.Errorf("table %s of sheet %q is not unique", table.Name, sheet)
+			}
+
+			tables[strings.ToLower(table.Name)] = true
+		}
+	}
+
+	if len(tables) != len(sheets)-1 {
+		t.Errorf("%d tables on %d dataset sheets", len(tables), len(sheets)-1)
+	}
+
+	rows, err := book.GetRows(summarySheet)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != len(sheets) {
+		t.Fatalf("%d summary rows, want %d", len(rows), len(sheets))
+	}
+
+	if rows[0][0] != "Subaccount" {
+		t.Errorf("summary header = %q", rows[0])
+	}
+
+	if last := rows[len(rows)-1]; last[0] != "Trading bot 2" || !strings.HasPrefix(last[2], "Trading b") {
+		t.Errorf("last summary row = %q", last)
+	}
+}